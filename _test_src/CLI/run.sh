@@ -32,3 +32,10 @@ gemp -format '	const %s = %s' 'K=1' dump
 echo Equivalent invocations:
 gemp -format '%s:%s' 'K=V1,V2' dump
 echo 'K=V1,V2' | gemp -format '%s:%s' -kvpluspath /dev/stdin dump
+
+echo Value lists as given, and quoted to split again into the same Values:
+gemp -format '	const %s = "%s"' 'P=C:\dir' 'S=a"b' dump
+gemp -format '%s=%s' 'K=V1\,V2,V3' dump
+gemp -format '%s=%s' 'K=V1\,V2,V3' dump -quote
+gemp -format '%s=%s' 'R=1..3,"4..6"' dump
+gemp -format '%s=%s' 'R=1..3,"4..6"' dump -quote
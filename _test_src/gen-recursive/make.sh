@@ -2,30 +2,22 @@
 
 . ./lib.sh
 
-rm -rf ${TOPOUTDIR}.old
-mv --update ${TOPOUTDIR} ${TOPOUTDIR}.old || true
-mkdir ${TOPOUTDIR}
-
 IKS='+'
 
-generate () {
-    set -e
-    templateName=$1
-    shift
+# X  One invocation expands every template below '_templates/'.  Each
+#    combination differing only in 'UintOperation' yields the same
+#    'main_test.go', which is written just once.
+# X  '-prune' removes outputs of an earlier run no longer generated, e.g. after
+#    a value is dropped from 'UintSize', as recorded in the manifest.
+(
+    cd _templates
     gemp -verbose \
          CodeGenWarning="Code generated by gemp -- DO NOT EDIT." \
-         UintSize=64,32,16 "$@" \
+         UintSize=64,32,16 \
+         UintOperation="Reverse,ReverseBytes" \
          gen -outtopdir ../$TOPOUTDIR -inkeyseparator ${IKS} \
-         $templateName
-
-    #    printf "gemp returned status %d\n" "$?"
-}
-
-(
-    cd _templates
-    generate testbits${IKS}UintSize/main_test.go
-    generate testbits${IKS}UintSize/loop${IKS}UintOperation${IKS}_test.go \
-             UintOperation="Reverse,ReverseBytes"
+             -clobber -prune \
+         .
 )
 
 go mod tidy
@@ -0,0 +1,23 @@
+// Template in gemp's 'token' dialect:  valid Go as it stands, so that
+// gofmt, vet and editors may work on it.  Try:
+//    go vet ./_templates/type-parameter+GoDataType+.go
+
+package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+type GEMP_GoDataType = uint64 // gemp:omit
+
+const expectedSize = /*GEMP:ExpectedSize*/ 8
+
+func main() {
+	var zeroValue GEMP_GoDataType
+
+	fmt.Printf("Zero value of type 'GEMP_GoDataType' is \"%#v\"\n", zeroValue)
+	fmt.Printf("Runtime reports type '%T' consumes %d bytes\n",
+		zeroValue, int(unsafe.Sizeof(zeroValue)))
+	fmt.Printf("Expected %d bytes\n", expectedSize)
+}
@@ -0,0 +1,52 @@
+#! /bin/sh
+
+set -ue
+
+usage () {
+    set +x
+    printf "%s\n" "$1"
+    printf "Examples:\n"
+    printf "\t%s %s\n" $0 \
+           "[ 'byte 1' | 'float64 8' | 'struct{a int32; b [9]bool} 16' | ... ]"
+    exit 1
+}
+
+if [ $# != 2 ]
+then
+    usage "Exactly two args expected, a Go type definition and its size in bytes."
+fi
+goDataType="$1"
+expectedSize="$2"
+
+EXAMPLE_BASENAME=type-parameter
+TEMPLATENAME=_templates/${EXAMPLE_BASENAME}+GoDataType+.go
+OUTFILE_SEPARATOR="__"
+
+(
+    set -x
+    gofmt -l ${TEMPLATENAME}
+    go vet ./${TEMPLATENAME}
+    gemp -format="${OUTFILE_SEPARATOR}%.0s%s" \
+       GoDataType="${goDataType}" \
+       ExpectedSize="${expectedSize}" \
+       gen \
+       -dialect token \
+       -inkeyseparator '+' \
+       -clobber \
+       -outtopdir . \
+       ./${TEMPLATENAME}
+)
+
+(
+    printf "\nNumber of lines should be same in both source -- \"%s\" -- and
+generated files, for ease of debugging with symbolic backtraces:\n\n" \
+           ${TEMPLATENAME}
+    set -x
+    wc --lines _templates/*.go | grep -v total
+)
+
+printf "\nTo run generated code:\n"
+for f in _templates/${EXAMPLE_BASENAME}${OUTFILE_SEPARATOR}*.go
+do
+    printf "\t%s\n" "go run \"./${f}\""
+done
@@ -0,0 +1,75 @@
+#! /bin/sh
+
+# Layers of Keys, in order of increasing precedence:
+#   '-kvdefaults' files, '-kvpluspath' files, GEMP_KV_ environment, command line.
+
+set -ue
+
+expect () {
+    if [ "$1" != "$2" ]
+    then
+        printf "FAIL: %s\n  got:\n%s\n  want:\n%s\n" "$3" "$1" "$2"
+        exit 1
+    fi
+    printf "ok: %s\n" "$3"
+}
+
+dump () {
+    gemp -format '%s=%s' -kvdefaults defaults.kv "$@" dump
+}
+
+expect "$(dump)" \
+"Arch=amd64,arm64
+Size=64
+Os=linux" \
+    "defaults alone"
+
+expect "$(dump -kvpluspath plus.kv)" \
+"Arch=amd64,arm64,386
+Size=32,64
+Os=linux,darwin" \
+    "file overrides and appends to defaults"
+
+expect "$(GEMP_KV_Arch=-=arm64 GEMP_KV_Size=16 dump -kvpluspath plus.kv)" \
+"Arch=amd64,386
+Size=16
+Os=linux,darwin" \
+    "environment removes from and overrides files"
+
+expect "$(GEMP_KV_Size=16 dump -kvpluspath plus.kv Size+=8 Os-=linux Arch=riscv64)" \
+"Arch=riscv64
+Size=16,8
+Os=darwin" \
+    "command line appends to, removes from and overrides environment"
+
+expect "$(dump -kvpluspath plus.kv -explain-vars Os-=linux 2>&1 >/dev/null)" \
+"Arch
+    amd64                defaults.kv:2 (=)
+    arm64                defaults.kv:2 (=)
+    386                  plus.kv:1 (+=)
+Size
+    32                   plus.kv:2 (=)
+    64                   plus.kv:2 (=)
+Os
+    darwin               plus.kv:3 (+=)" \
+    "-explain-vars names the layer of each Value"
+
+if dump Missing-=x 2>/dev/null
+then
+    echo "FAIL: removal from a Key never assigned accepted"
+    exit 1
+fi
+echo "ok: removal from a Key never assigned rejected"
+
+if dump Size=8 Size=16 2>/dev/null
+then
+    echo "FAIL: Key assigned twice on the command line accepted"
+    exit 1
+fi
+echo "ok: Key assigned twice on the command line rejected"
+
+expect "$(dump Size=8 Size+=16)" \
+"Arch=amd64,arm64
+Size=8,16
+Os=linux" \
+    "command line may append to its own assignment"
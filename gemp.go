@@ -3,27 +3,22 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
-	"regexp"
-	"runtime"
-	"strconv"
+	"sort"
 	"strings"
 
+	"github.com/dmullis/gemp/generator"
 	"github.com/dmullis/gemp/internal"
+	"github.com/dmullis/gemp/internal/dump"
 	"github.com/dmullis/gemp/internal/gen"
-)
-
-const (
-	UNINITIALIZED_PATH = ""
-
-	VALUE_LIST_COMMA_SEPARATOR = ","
-	ValueListRegexp            = "[^" + VALUE_LIST_COMMA_SEPARATOR + "]+"
+	"github.com/dmullis/gemp/internal/kvfile"
 )
 
 const (
@@ -48,7 +43,7 @@ var (
 	//    fmt.Printf(*format, ...) to produce wrong output.
 	// XX As an expedience, 'gen' will always tack on a final newline.
 	format = flag.String("format",
-		"%-.s-%s", // X  'gen' -- replace '+' with '-', Key with Value
+		generator.DefaultFormat, // X  'gen' -- replace '+' with '-', Key with Value
 		//"%s=%s",           // X  'dump' -- for reading by 'sh'
 		//"const %s=\"%s\"", // X  'dump' -- Go or JavaScript
 
@@ -62,20 +57,45 @@ format string.
 Note that prefixing with '%-.s', drops a string from output.
 `)
 
-	// XX  Add to test suite.
-	KVplusPath = flag.String("kvpluspath", UNINITIALIZED_PATH,
-		`Alternative to specifying K=V+ pairs on the command line. Arg is a
-path to an input file containing Key=Value+ pairs, in 'sh' syntax.
-Lines of commentary, beginning with '#', are ignored.`)
+	explainVars = flag.Bool("explain-vars", false,
+		`Write to stderr each final Value of each Key, along with the layer
+supplying it: '-kvdefaults' file, '-kvpluspath' file, environment, or
+command line.`)
+
+	valueSep = flag.String("valuesep", internal.ValueListSeparator,
+		`Separator of the Values of each K=V1,V2...Vn pair, on the command
+line or in a '-kvpluspath' file.  A Value containing the separator may be
+enclosed in double quotes, as in K='"a,b",c', within which \" and \\
+escape a quote and a backslash; or the separator may be escaped by a
+backslash, as in K='a\,b,c'.  An empty Value may be given as "".`)
 
 	verbose = flag.Bool("verbose", false,
 		`Log heavily`)
 
+	kvplusPaths, kvDefaultsPaths []string
+
 	commandName string
 	//kvpArgs []internal.KvpArg // preserves original order of keys
 )
 
 func init() {
+	flag.Var((*pathsFlag)(&kvDefaultsPaths), "kvdefaults",
+		`Path to a file of Key=Value+ assignments as for '-kvpluspath', forming
+the lowest layer of precedence.  May be repeated.`)
+	flag.Var((*pathsFlag)(&kvplusPaths), "kvpluspath",
+		`Alternative to specifying K=V+ pairs on the command line. Arg is a
+path to an input file containing Key=Value+ assignments, in a subset
+of 'sh' syntax: quoting, backslash escapes, line continuations, 'export',
+'#' comments, and expansion of $NAME and ${NAME} from earlier assignments
+or the environment.  Quoted values may span lines.  May be repeated.
+
+Keys are taken from layers of increasing precedence: '-kvdefaults'
+files, '-kvpluspath' files, environment variables named `+internal.EnvPrefix+`K,
+then the command line.  In each, K=V1,V2 overrides the Values of earlier
+layers, K+=V3 appends to them, and K-=V1 removes from them.  In the
+environment, the Value+ may begin with += or -= to the same effect.
+On the command line, a Key may be assigned by K= only once.`)
+
 	// X  Any environment variables specified in the form 'K=\tV' appear here as 'K=\\tV'
 	// envir := os.Environ()
 
@@ -100,6 +120,13 @@ func usage() {
         Any number of Key=Value+ pairs, where Value+ may be a comma-
 	separated list of multiple string values to be substituted serially
 	into each of multiple output directories or files.
+	A Key may declare the type of its Values as K:Type=V1,V2...Vn,
+	where Type is one of int, uint, float, bool or string.  Values
+	of undeclared type are taken as 'int' if they parse as decimal
+	integers, and otherwise as 'string'.
+	Unquoted integer ranges expand in place: 1..8, 0..64:8 (step),
+	and 1..1024*2 (geometric), declaring the Key 'int'.  'dump' leaves
+	them as given, unless '-quote'.
 `)
 	if *helpAsMarkdown {
 		internal.ToggleCode("")
@@ -107,7 +134,7 @@ func usage() {
 	commandSynopsis := `
  gen
 
-  'gen' scans a single named input file in the format specified by the
+  'gen' scans named input files, or trees of them, in the format specified by the
   Go standard library 'template' package.  If an expansion of a known
   Key is found, each of its Values is iteratively substituted
   in, with output written to newly created files.  A K=V1,V2,...Vn pair
@@ -123,7 +150,9 @@ func usage() {
   Result is written to stdout, with the format string expanded by each
   Key-Value pair on successive lines of the output.  Any value list
   V1,V2...Vn passed to 'dump' is not expanded or parsed further but
-  merely treated as a single string.
+  merely treated as a single string, unless 'dump -quote' is given.
+  For 'dump'-specific help:
+      $ gemp -h dump
 `
 	fpf("%s", commandSynopsis)
 }
@@ -135,10 +164,23 @@ func cliUsage() string {
 		func(f *flag.Flag) {
 			flagUsage += fmt.Sprintf("[-%s=%s] ", f.Name, f.DefValue)
 		})
-	return fmt.Sprintf("%s %s[K=V1,V2...Vn]* (gen [flags] input_file | dump)\n\n",
+	return fmt.Sprintf("%s %s[K=V1,V2...Vn]* (gen [flags] template_path... | dump [flags])\n\n",
 		exeName, flagUsage)
 }
 
+// Exit status reported to the shell, by category of error.
+const (
+	exitUsage = 1 + iota
+	exitKvSyntax
+	exitTemplateParse
+	exitTemplateExec
+	exitPathCollision
+	exitLineCount
+	exitIO
+	exitCheck
+	exitFormat
+)
+
 func main() {
 	flag.Usage = usage
 
@@ -146,8 +188,14 @@ func main() {
 	if !flag.Parsed() {
 		log.Fatalln("flag.Parsed() == false")
 	}
+	if *valueSep == "" || strings.ContainsAny(*valueSep, `"\`) {
+		usageWhy(fmt.Sprintf("-valuesep '%s' must be non-empty, without '\"' or '\\'", *valueSep))
+	}
 
-	kvpArgs, nonKvpArgs := getKVplus()
+	kvpArgs, nonKvpArgs, err := getKVplus()
+	if err != nil {
+		exitOn(err)
+	}
 	if len(nonKvpArgs) == 0 {
 		if *help {
 			usage()
@@ -163,7 +211,7 @@ func main() {
 		case Gen:
 			gen.UsageDump(*helpAsMarkdown, cliUsage())
 		case Dump:
-			usage()
+			dump.UsageDump(*helpAsMarkdown, cliUsage())
 		}
 		os.Exit(0)
 	}
@@ -174,26 +222,34 @@ func main() {
 
 	switch commandName {
 	case Gen:
-		numLines := gen.ParseArgs(nonKvpArgs[1:], cliUsage())
-		gen.ExpandTemplate(*verbose, *format, numLines,
-			kvpArgs)
+		args, err := gen.ParseArgs(nonKvpArgs[1:])
+		if err != nil {
+			gen.UsageDump(false, cliUsage())
+			fmt.Fprintf(os.Stderr, "gen command args: '%v'\n\n", nonKvpArgs[1:])
+			fmt.Fprintf(os.Stderr, "\n%s\n\n", err)
+			os.Exit(exitUsage)
+		}
+		args.Verbose = *verbose
+		args.Format = *format
+		args.KvpArgs = kvpArgs
+		if err := gen.Run(args, os.Stdout); err != nil {
+			exitOn(err)
+		}
 	case Dump:
-		for _, kvp := range kvpArgs {
-			kvpValues := kvp.Values[0]
-			for _, v := range kvp.Values[1:] {
-				kvpValues += VALUE_LIST_COMMA_SEPARATOR + v
-			}
-			expand := fmt.Sprintf(*format, kvp.Key, kvpValues)
-			if expand[:2] == "%!" {
-				usageWhy(fmt.Sprintf(
-					"format (%s) failed to expand arg (%s=%s):\n\t%s\n",
-					*format, kvp.Key, kvpValues, expand))
-			}
-			if _, err := io.WriteString(os.Stdout, expand+"\n"); err != nil {
-				usageWhy(fmt.Sprintf("io.WriteString() failed: %v\n", err))
-			}
+		args, err := dump.ParseArgs(nonKvpArgs[1:])
+		if err != nil {
+			dump.UsageDump(false, cliUsage())
+			fmt.Fprintf(os.Stderr, "\n%s\n\n", err)
+			os.Exit(exitUsage)
+		}
+		args.ValueSep = *valueSep
+		err = dump.Run(args, *format, kvpArgs, os.Stdout)
+		var formatErr *dump.FormatError
+		if errors.As(err, &formatErr) {
+			usageWhy(err.Error())
+		} else if err != nil {
+			exitOn(err)
 		}
-		return
 	default:
 		usageWhy(fmt.Sprintf("No such command: %s", commandName))
 	}
@@ -202,123 +258,265 @@ func main() {
 func usageWhy(why string) {
 	usage()
 	fmt.Fprintf(os.Stderr, "\n%s\n\n", why)
-	os.Exit(1)
+	os.Exit(exitUsage)
 }
 
-func getKVplus() (kvpArgs []internal.KvpArg, remainingArgs []string) {
-	kvpArgs, remainingArgs = scanForKVplusArgs(flag.Args())
+// pathsFlag accumulates each use of a repeatable flag naming a file.
+type pathsFlag []string
 
-	// XX  File must be parsed before KV pairs on command line if latter are to override.
-	if *KVplusPath != "" {
-		kvpArgs = append(kvpArgs, scanKVplusFile(*KVplusPath)...)
+func (f *pathsFlag) String() string {
+	if f == nil {
+		return ""
 	}
-	return
+	return strings.Join(*f, " ")
+}
+
+func (f *pathsFlag) Set(path string) error {
+	*f = append(*f, path)
+	return nil
 }
 
+// exitOn reports 'err', then exits with a status distinguishing its category.
+func exitOn(err error) {
+	var (
+		kvSyntaxErr      *internal.KvSyntaxError
+		parseErr         *generator.TemplateParseError
+		execErr          *generator.TemplateExecError
+		pathCollisionErr *generator.PathCollisionError
+		lineCountErr     *generator.LineCountError
+		checkErr         *generator.CheckError
+		filterErr        *generator.FilterError
+		lockstepErr      *generator.LockstepError
+		dataErr          *generator.DataError
+		formatErr        *generator.FormatError
+	)
+	status := exitIO
+	switch {
+	case errors.As(err, &filterErr), errors.As(err, &lockstepErr):
+		status = exitUsage
+	case errors.As(err, &kvSyntaxErr), errors.As(err, &dataErr):
+		status = exitKvSyntax
+	case errors.As(err, &parseErr):
+		status = exitTemplateParse
+	case errors.As(err, &execErr):
+		status = exitTemplateExec
+	case errors.As(err, &pathCollisionErr):
+		status = exitPathCollision
+	case errors.As(err, &lineCountErr):
+		status = exitLineCount
+	case errors.As(err, &checkErr):
+		status = exitCheck
+	case errors.As(err, &formatErr):
+		status = exitFormat
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", path.Base(os.Args[0]), err)
+	os.Exit(status)
+}
+
+func getKVplus() (kvpArgs []internal.KvpArg, remainingArgs []string, err error) {
+	// X  Layers in order of increasing precedence.
+	var ops []internal.KvpOp
+	for _, paths := range [][]string{kvDefaultsPaths, kvplusPaths} {
+		for _, path := range paths {
+			fileOps, err := scanKVplusFile(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			ops = append(ops, fileOps...)
+		}
+	}
+	envOps, err := scanEnvironment(os.Environ())
+	if err != nil {
+		return nil, nil, err
+	}
+	ops = append(ops, envOps...)
+	argOps, remainingArgs, err := scanForKVplusArgs(flag.Args())
+	if err != nil {
+		return nil, nil, err
+	}
+	ops = append(ops, argOps...)
+
+	kvpArgs, origins, err := internal.ResolveLayers(ops, *valueSep)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *explainVars {
+		explain(os.Stderr, kvpArgs, origins)
+	}
+	return kvpArgs, remainingArgs, nil
+}
+
+// explain writes each final Value of 'kvpArgs', with the layer supplying it.
+func explain(w io.Writer, kvpArgs []internal.KvpArg, origins map[string][]internal.ValueOrigin) {
+	for _, kvp := range kvpArgs {
+		key := kvp.Key
+		if kvp.Type != "" {
+			key += ":" + kvp.Type
+		}
+		fmt.Fprintf(w, "%s\n", key)
+		for _, o := range origins[kvp.Key] {
+			where := o.Source
+			if o.Line > 0 {
+				where = fmt.Sprintf("%s:%d", o.Source, o.Line)
+			}
+			fmt.Fprintf(w, "    %-20s %s (%s)\n", o.Value, where, o.Op)
+		}
+	}
+}
+
+const (
+	commandLineSource = "command line"
+	environmentSource = "environment"
+)
+
 func scanForKVplusArgs(args []string) (
-	kvpArgs []internal.KvpArg, remainingArgs []string) {
+	ops []internal.KvpOp, remainingArgs []string, err error) {
 
+	assigned := make(map[string]bool)
 	for iArg, arg := range args {
-		kvp := strings.Split(arg, "=")
-		if len(kvp) != 2 {
+		// X  Split at the first '=' only, so that Values may contain '='.
+		eq := strings.IndexByte(arg, '=')
+		if eq < 0 {
 			remainingArgs = args[iArg:]
 			break
 		}
-		newKvpArg := newKVplusPair(kvp)
-
-		// Search earlier Keys for duplicates.
-		//   XX  N^2 in number of Keys -- use a map instead?
-		for _, kvp := range kvpArgs {
-			if kvp.Key == newKvpArg.Key {
-				// XX  ? Add option to accumulate the values K=V1, K=V2, ... ,
-				//       as an alternative to comma-separated syntax K=V1,V2,...
-				log.Fatalf("Duplicate key specified: '%v', '%v'", kvp, newKvpArg)
+		kvp := []string{arg[:eq], arg[eq+1:]}
+		op, err := newKVplusPair(kvp, commandLineSource, iArg+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		// X  Overriding is for later layers;  a Key assigned twice within
+		//    this one is more likely mistyped.  K+= and K-= amend it.
+		if op.Op == internal.OpAssign {
+			if assigned[op.Key] {
+				return nil, nil, &internal.KvSyntaxError{
+					Source: commandLineSource,
+					Line:   iArg + 1,
+					Text:   arg,
+					Reason: fmt.Sprintf("duplicate Key '%s'", op.Key),
+				}
 			}
+			assigned[op.Key] = true
 		}
-		kvpArgs = append(kvpArgs, newKvpArg)
+		ops = append(ops, op)
 	}
 	return
 }
 
-func newKVplusPair(newKvp []string) internal.KvpArg {
-	vetKVstring(newKvp)
-	return parseKvpArg(newKvp)
+// scanEnvironment finds Keys in environment variables named with EnvPrefix,
+// sorted by name.  A Value+ beginning "+=" or "-=" appends to, or removes
+// from, Values of earlier layers.
+func scanEnvironment(environ []string) (ops []internal.KvpOp, err error) {
+	sort.Strings(environ)
+	for _, env := range environ {
+		if !strings.HasPrefix(env, internal.EnvPrefix) {
+			continue
+		}
+		eq := strings.IndexByte(env, '=')
+		key, value := env[len(internal.EnvPrefix):eq], env[eq+1:]
+		for _, opPrefix := range []string{internal.OpAppend, internal.OpRemove} {
+			if strings.HasPrefix(value, opPrefix) {
+				key += opPrefix[:1]
+				value = value[len(opPrefix):]
+			}
+		}
+		source := environmentSource + " " + env[:eq]
+		op, err := newKVplusPair([]string{key, value}, source, 0)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
 }
 
-func vetKVstring(kvplus []string) {
-	reportFatal := func(format string) {
-		caller := func(howHigh int) string {
-			pc, file, line, ok := runtime.Caller(howHigh)
-			_ = pc
-			if !ok {
-				return ""
-			}
-			baseFileName := file[strings.LastIndex(file, "/")+1:]
-			return baseFileName + ":" + strconv.Itoa(line)
+func newKVplusPair(newKvp []string, source string, line int) (internal.KvpOp, error) {
+	if err := vetKVstring(newKvp, source, line); err != nil {
+		return internal.KvpOp{}, err
+	}
+	return parseKvpArg(newKvp, source, line)
+}
+
+func vetKVstring(kvplus []string, source string, line int) error {
+	syntaxError := func(reason string) error {
+		return &internal.KvSyntaxError{
+			Source: source,
+			Line:   line,
+			Text:   strings.Join(kvplus, "="),
+			Reason: reason,
 		}
-		fmt.Fprintf(os.Stderr, format, kvplus)
-		//fmt.Fprintf(os.Stderr, "Reading template file %s", templatePath)
-		fmt.Fprintf(os.Stderr, " Called from line %3s <- %3s <- %3s\n",
-			caller(2), caller(3), caller(4))
-		//usage()
-		log.Fatalln("FATAL")
 	}
 	if len(kvplus) != 2 {
-		reportFatal("Appears not to be a Key=Value+ pair: %v\n")
+		return syntaxError("appears not to be a Key=Value+ pair")
 	}
 	if len(kvplus[0]) <= 0 {
-		reportFatal("Key side of Key=Value+ pair empty: \"%v\"\n")
+		return syntaxError("Key side of Key=Value+ pair empty")
 	}
 	if len(kvplus[1]) <= 0 {
-		reportFatal("Value+ side of Key=Value+ pair empty: \"%v\"\n")
+		return syntaxError("Value+ side of Key=Value+ pair empty")
 	}
+	return nil
 }
 
-func parseKvpArg(rawKvp []string) (kvpArg internal.KvpArg) {
-	kvpArg.Key = rawKvp[0]
-	valueStringsRE := regexp.MustCompile("(" + ValueListRegexp + ")")
-	commaSeparatedValues := valueStringsRE.FindAllStringSubmatch(rawKvp[1], -1)
-	if len(commaSeparatedValues) < 1 {
-		log.Fatalf("Key= '%s=' specified, but no value found on RHS", kvpArg.Key)
+// parseKvpArg parses K=V1,V2...Vn, as split at its first '=' into 'rawKvp',
+// with K possibly of form K:Type, and '=' possibly preceded by '+' or '-'.
+func parseKvpArg(rawKvp []string, source string, line int) (op internal.KvpOp, err error) {
+	syntaxError := func(reason string) error {
+		return &internal.KvSyntaxError{
+			Source: source,
+			Line:   line,
+			Text:   strings.Join(rawKvp, "="),
+			Reason: reason,
+		}
+	}
+	op.Source, op.Line = source, line
+	op.Key, op.Op = internal.SplitKeyOp(rawKvp[0])
+	// K:Type=V1,V2...Vn
+	if i := strings.IndexByte(op.Key, ':'); i >= 0 {
+		op.Key, op.Type = op.Key[:i], op.Key[i+1:]
+		if !internal.IsValueType(op.Type) {
+			err = syntaxError(fmt.Sprintf("unknown type '%s', not one of %s",
+				op.Type, strings.Join(internal.ValueTypes, ", ")))
+			return
+		}
+	}
+	if op.Key == "" {
+		err = syntaxError("Key side of Key=Value+ pair empty")
+		return
+	}
+	values, intRange, err := internal.ParseValueList(rawKvp[1], *valueSep)
+	if err != nil {
+		err = syntaxError(err.Error())
+		return
+	}
+	// X  Values expanded from ranges remain integers despite '-notypeguess'.
+	if intRange && op.Type == "" && op.Op == internal.OpAssign {
+		op.Type = "int"
 	}
-	// split out the Values into a slice of string
-	for _, match := range commaSeparatedValues {
-		kvpArg.Values = append(kvpArg.Values, match[1])
+	if len(values) < 1 {
+		err = syntaxError("Key= specified, but no value found on RHS")
+		return
 	}
+	op.Values, op.Raw = values, rawKvp[1]
 	return
 }
 
-func scanKVplusFile(kVplusPath string) (kvpArgs []internal.KvpArg) {
-	kvfile, err := os.Open(kVplusPath)
+func scanKVplusFile(kVplusPath string) (ops []internal.KvpOp, err error) {
+	text, err := ioutil.ReadFile(kVplusPath)
 	if err != nil {
-		log.Fatalln(err)
-	}
-	scanner := bufio.NewScanner(kvfile)
-	// Iterate over each (non-comment) line of file contents.
-	for scanner.Scan() {
-		kvp := strings.Split(scanner.Text(), "=")
-		kvp[0] = strings.TrimSpace(kvp[0])
-		if len(kvp[0]) == 0 || kvp[0][0] == '#' {
-			continue
-		}
-		if len(kvp) < 2 {
-			log.Fatalf("len(kvp)==%d < 2; kvp==%v", len(kvp), kvp)
-		}
-		// find end of RHS 'Value+' string
-		if len(kvp[1]) >= 2 && strings.IndexAny(string(kvp[1][0]), "'\"") >= 0 {
-			quoteChar := kvp[1][0]
-			close := strings.IndexByte(string(kvp[1][1:]), quoteChar)
-			kvp[1] = kvp[1][1 : 1+close]
-		} else { // no quoting found, strip from leftmost white space onward
-			close := strings.IndexAny(string(kvp[1]), " \t")
-			if close >= 0 {
-				kvp[1] = kvp[1][:close]
-			}
-		}
-		kvpArgs = append(kvpArgs, newKVplusPair(kvp))
+		return nil, err
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalln(err)
+	assignments, err := kvfile.Parse(kVplusPath, text, os.LookupEnv)
+	if err != nil {
+		return nil, err
 	}
-	return
+	for _, a := range assignments {
+		lhs := a.Name + strings.TrimSuffix(a.Op, "=")
+		op, err := newKVplusPair([]string{lhs, a.Value}, kVplusPath, a.Line)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
 }
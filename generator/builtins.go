@@ -0,0 +1,90 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// BuiltinsKey binds the Builtins of each expansion, as in '{{.gemp.OutPath}}'.
+// No Key of a K=V pair, nor of Options.Data, may take it.
+const BuiltinsKey = "gemp"
+
+// Version of gemp, as reported by '{{.gemp.Version}}'.  Defaults to that of
+// the main module as built, e.g. by 'go install'; may be set at link time
+// by '-ldflags -X github.com/dmullis/gemp/generator.Version=v1.2.3'.
+var Version = moduleVersion()
+
+func moduleVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// Builtins describes one expansion of one template file, for the template
+// itself.
+type Builtins struct {
+	TemplatePath string // as given or found by walking a directory
+	TemplateBase string // final element of TemplatePath
+	OutPath      string
+	OutBase      string // final element of OutPath
+	OutDir       string // directory of OutPath, as is "thisDir"
+	Index        int    // of this combination among those expanded, from 0
+	Total        int    // number of combinations expanded
+	// Keys of the K=V pairs, in order of first appearance
+	Keys []string
+	// All Values of each of Keys, converted to their types
+	Values map[string][]interface{}
+	// Version of gemp
+	Version string
+	// Time of generation:  that of SOURCE_DATE_EPOCH if set, for
+	// reproducible output, else the start of the run; in UTC
+	Timestamp time.Time
+}
+
+// String summarizes 'b' for messages listing the bindings of a combination.
+func (b *Builtins) String() string {
+	return fmt.Sprintf("%s -> %s, %d of %d", b.TemplatePath, b.OutPath, b.Index+1, b.Total)
+}
+
+// timestamp returns the time of generation, per SOURCE_DATE_EPOCH if set.
+func timestamp() (time.Time, error) {
+	// X  https://reproducible-builds.org/specs/source-date-epoch/
+	epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || epoch == "" {
+		return time.Now().UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH '%s' not an integer count of seconds", epoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// builtins returns the Builtins of job 'j', expanding the 'index'th of
+// 'total' combinations.
+func (g *Generator) builtins(j *job, index, total int) *Builtins {
+	b := &Builtins{
+		TemplatePath: j.path,
+		TemplateBase: filepath.Base(j.path),
+		OutPath:      j.outPath,
+		OutBase:      filepath.Base(j.outPath),
+		OutDir:       j.outDir,
+		Index:        index,
+		Total:        total,
+		Values:       make(map[string][]interface{}, len(g.opts.KvpArgs)),
+		Version:      Version,
+		Timestamp:    g.timestamp,
+	}
+	for i, kvp := range g.opts.KvpArgs {
+		b.Keys = append(b.Keys, kvp.Key)
+		b.Values[kvp.Key] = g.values[i]
+	}
+	return b
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmullis/gemp/internal"
+)
+
+// setEnv sets environment variable 'name' for the duration of a test.
+func setEnv(t *testing.T, name, value string) {
+	t.Helper()
+	old, had := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestBuiltins(t *testing.T) {
+	setEnv(t, "SOURCE_DATE_EPOCH", "86400")
+	outTopDir := t.TempDir()
+	g, err := New(Options{
+		TemplatePaths:  []string{"d+K/t.txt"},
+		TemplateText:   "{{with .gemp}}{{.TemplateBase}} {{.OutBase}} {{.Index}}/{{.Total}} {{.Keys}} {{index .Values \"K\"}} {{.Timestamp.Format \"2006-01-02\"}}{{end}}",
+		InKeySeparator: "+",
+		KvpArgs: []KvpArg{
+			{Key: "K", Values: []string{"1", "2", "3"}},
+			{Key: "S", Values: []string{"a"}},
+		},
+		Where:     "K != 2",
+		OutTopDir: outTopDir,
+		Logger:    quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := g.jobs()
+	tests := []struct {
+		outDir string
+		want   string
+	}{
+		{"d-1", "t.txt t.txt 0/2 [K S] [1 2 3] 1970-01-02"},
+		{"d-3", "t.txt t.txt 1/2 [K S] [1 2 3] 1970-01-02"},
+	}
+	if len(jobs) != len(tests) {
+		t.Fatalf("got %d jobs, want %d", len(jobs), len(tests))
+	}
+	for i, tt := range tests {
+		b := jobs[i].bindings[BuiltinsKey].(*Builtins)
+		if b.OutDir != filepath.Join(outTopDir, tt.outDir) || b.OutPath != filepath.Join(b.OutDir, "t.txt") {
+			t.Errorf("got OutDir %s, OutPath %s, want below %s", b.OutDir, b.OutPath, tt.outDir)
+		}
+		if b.Version != Version || b.TemplatePath != "d+K/t.txt" {
+			t.Errorf("got Version %s, TemplatePath %s", b.Version, b.TemplatePath)
+		}
+		var out bytes.Buffer
+		if err := jobs[i].tmpl.Execute(&out, jobs[i].bindings); err != nil {
+			t.Fatal(err)
+		}
+		if got, _, _ := resolveLineMarkers(out.Bytes(), "t.txt"); string(got) != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	tests := []struct {
+		epoch string
+		want  time.Time
+		fails bool
+	}{
+		{"0", time.Unix(0, 0).UTC(), false},
+		{"1700000000", time.Unix(1700000000, 0).UTC(), false},
+		{"soon", time.Time{}, true},
+		{"1.5", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.epoch, func(t *testing.T) {
+			setEnv(t, "SOURCE_DATE_EPOCH", tt.epoch)
+			got, err := timestamp()
+			if (err != nil) != tt.fails || !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("got %v, %v, want %v, failure %v", got, err, tt.want, tt.fails)
+			}
+		})
+	}
+
+	setEnv(t, "SOURCE_DATE_EPOCH", "")
+	before := time.Now()
+	if got, err := timestamp(); err != nil || got.Before(before.Add(-time.Second)) {
+		t.Errorf("got %v, %v, want about now", got, err)
+	}
+}
+
+func TestBuiltinsKeyReserved(t *testing.T) {
+	if err := checkData(nil, []KvpArg{{Key: BuiltinsKey}}); err == nil {
+		t.Error("Key of a K=V pair took BuiltinsKey")
+	} else {
+		var syntaxErr *internal.KvSyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("got error %v, want KvSyntaxError", err)
+		}
+	}
+	err := checkData(map[string]interface{}{BuiltinsKey: 1}, nil)
+	var dataErr *DataError
+	if !errors.As(err, &dataErr) || dataErr.Key != BuiltinsKey {
+		t.Errorf("got error %v, want DataError of Key '%s'", err, BuiltinsKey)
+	}
+}
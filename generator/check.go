@@ -0,0 +1,113 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/dmullis/gemp/internal/diff"
+)
+
+type (
+	// CheckError reports output files out of date with respect to their
+	// templates.
+	CheckError struct {
+		Missing   []string // generated, but absent on disk
+		Extra     []string // recorded in manifest, but no longer generated
+		Differing []FileDiff
+	}
+
+	// FileDiff holds the differences from a file on disk to its expected
+	// content, in unified format.
+	FileDiff struct {
+		OutPath string
+		Diff    string
+	}
+)
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("generated files out of date: %d missing, %d extra, %d differing",
+		len(e.Missing), len(e.Extra), len(e.Differing))
+}
+
+func (e *CheckError) empty() bool {
+	return len(e.Missing)+len(e.Extra)+len(e.Differing) == 0
+}
+
+// Check renders every combination in memory, comparing each against the
+// file at its output path, without writing anything.  If a manifest of an
+// earlier run exists, named by Options.ManifestName or else
+// DefaultManifestName, files it records which are no longer generated are
+// reported as Extra.  Returns a *CheckError if any file is out of date.
+func (g *Generator) Check() error {
+	report := &CheckError{}
+	type outcome struct {
+		missing bool
+		diff    string
+	}
+	jobs := g.jobs()
+	// X  Each worker writes only the element of its own job.
+	outcomes := make([]outcome, len(jobs))
+	generated := make(map[string]bool, len(jobs))
+	err := g.runJobs(jobs,
+		func(j *job) error {
+			r, err := g.render(j)
+			if err != nil || j.isDuplicate() {
+				return err
+			}
+			var o outcome
+			onDisk, err := ioutil.ReadFile(j.outPath)
+			if os.IsNotExist(err) {
+				o.missing = true
+			} else if err != nil {
+				return err
+			} else if !bytes.Equal(onDisk, r.content) {
+				o.diff = diff.Unified(j.outPath+"\t(on disk)", j.outPath+"\t(generated)",
+					string(onDisk), string(r.content))
+			}
+			outcomes[j.index] = o
+			return nil
+		},
+		func(j *job) error {
+			generated[j.outPath] = true
+			o := outcomes[j.index]
+			if o.missing {
+				report.Missing = append(report.Missing, j.outPath)
+			} else if o.diff != "" {
+				report.Differing = append(report.Differing, FileDiff{j.outPath, o.diff})
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	manifestPath := g.ManifestPath()
+	if manifestPath == "" {
+		manifestPath = path.Join(g.opts.OutTopDir, DefaultManifestName)
+	}
+	m, err := ReadManifest(manifestPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if m != nil {
+		for _, me := range m.Entries {
+			outPath := path.Join(g.opts.OutTopDir, me.OutPath)
+			if generated[outPath] {
+				continue
+			}
+			if _, err := os.Stat(outPath); err == nil {
+				report.Extra = append(report.Extra, outPath)
+			}
+		}
+	}
+
+	if report.empty() {
+		return nil
+	}
+	return report
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dmullis/gemp/internal"
+)
+
+// DataError reports structured data that could not be read, or whose
+// Keys collide with those of K=V pairs.
+type DataError struct {
+	Path   string // empty if not read from a file
+	Key    string // empty unless a collision
+	Reason string
+}
+
+func (e *DataError) Error() string {
+	where := "data"
+	if e.Path != "" {
+		where = e.Path
+	}
+	if e.Key != "" {
+		return fmt.Sprintf("%s: key '%s' %s", where, e.Key, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s", where, e.Reason)
+}
+
+// ReadData reads a JSON object from the file at 'dataPath', for use as
+// Options.Data.  Numbers written without a decimal point or exponent, and
+// within the range of 'int', are returned as 'int', so that templates may
+// compare them against integer constants; others, even '1.0' or '1e3', as
+// 'float64'.
+func ReadData(dataPath string) (map[string]interface{}, error) {
+	text, err := ioutil.ReadFile(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	var data map[string]interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, &DataError{Path: dataPath, Reason: err.Error()}
+	}
+	if dec.More() {
+		return nil, &DataError{Path: dataPath, Reason: "more than one JSON value found"}
+	}
+	if data == nil {
+		return nil, &DataError{Path: dataPath, Reason: "not a JSON object"}
+	}
+	return convertNumbers(data).(map[string]interface{}), nil
+}
+
+// convertNumbers replaces each json.Number within 'v' by 'int' or 'float64'.
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = convertNumbers(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = convertNumbers(elem)
+		}
+	}
+	return v
+}
+
+// syntheticKeys are bound by gemp itself, alongside K=V pairs and Data.
+var syntheticKeys = []string{BuiltinsKey, "thisDir"}
+
+// checkData ensures no Key of 'data' collides with one of 'kvpArgs', and
+// neither collides with a synthetic binding.
+func checkData(data map[string]interface{}, kvpArgs []KvpArg) error {
+	for _, kvp := range kvpArgs {
+		if _, ok := data[kvp.Key]; ok {
+			return &DataError{Key: kvp.Key, Reason: "collides with Key of a K=V pair"}
+		}
+		for _, synthetic := range syntheticKeys {
+			if kvp.Key == synthetic {
+				return &internal.KvSyntaxError{
+					Source: "K=V pairs",
+					Text:   kvp.Key,
+					Reason: "Key reserved for a synthetic binding",
+				}
+			}
+		}
+	}
+	for _, synthetic := range syntheticKeys {
+		if _, ok := data[synthetic]; ok {
+			return &DataError{Key: synthetic, Reason: "collides with a synthetic binding"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadDataNumbers(t *testing.T) {
+	tests := []struct {
+		json string
+		want interface{}
+	}{
+		{`1`, 1},
+		{`-7`, -7},
+		{`0`, 0},
+		{`1.0`, 1.0},
+		{`1e3`, 1000.0},
+		{`2.5`, 2.5},
+		{`1E-2`, 0.01},
+		{`99999999999999999999`, 1e20},
+		{`[1, 1.0]`, []interface{}{1, 1.0}},
+		{`{"n": 1e3}`, map[string]interface{}{"n": 1000.0}},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			dataPath := filepath.Join(dir, "data.json")
+			if err := ioutil.WriteFile(dataPath, []byte(`{"V": `+tt.json+`}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ReadData(dataPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := data["V"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDataErrors(t *testing.T) {
+	tests := []struct {
+		json   string
+		reason string
+	}{
+		{`null`, "not a JSON object"},
+		{`{} {}`, "more than one JSON value found"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			dataPath := filepath.Join(dir, "data.json")
+			if err := ioutil.WriteFile(dataPath, []byte(tt.json), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadData(dataPath)
+			var dataErr *DataError
+			if !errors.As(err, &dataErr) || dataErr.Reason != tt.reason {
+				t.Errorf("got error %v, want DataError: %s", err, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default action delimiters, as of text/template.
+const (
+	DefaultLeftDelim  = "{{"
+	DefaultRightDelim = "}}"
+)
+
+// DelimsDirective, if it opens a comment on the first line of a template
+// file or include file, overrides Options.LeftDelim and Options.RightDelim
+// for that file by the two words following it, e.g.
+//
+//	// gemp:delims /*{{ }}*/
+//
+// The comment may begin with any of delimsCommentPrefixes, optionally
+// indented, and separated from the directive by white space.  The line
+// holding the directive is expanded as an empty line.
+const DelimsDirective = "gemp:delims"
+
+var delimsCommentPrefixes = []string{"//", "#", "/*"}
+
+// fileDelims returns the action delimiters of 'text', read from
+// 'templatePath', along with 'text' to be parsed, with any directive line
+// emptied.
+func (g *Generator) fileDelims(templatePath, text string) (left, right, body string, err error) {
+	firstLine := text
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		firstLine = text[:i]
+	}
+	args, ok := delimsArgs(firstLine)
+	if !ok {
+		return g.opts.LeftDelim, g.opts.RightDelim, text, nil
+	}
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return "", "", "", &TemplateParseError{
+			TemplatePath: templatePath,
+			Line:         1,
+			Err:          fmt.Errorf("'%s' requires left and right delimiters", DelimsDirective),
+		}
+	}
+	// X  Keep the newline, so that line numbers of the rest are unchanged.
+	return fields[0], fields[1], text[len(firstLine):], nil
+}
+
+// delimsArgs returns what follows DelimsDirective on 'line', if it opens a
+// comment there.
+func delimsArgs(line string) (string, bool) {
+	line = strings.TrimLeft(line, " \t")
+	for _, prefix := range delimsCommentPrefixes {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		rest := strings.TrimLeft(line[len(prefix):], " \t")
+		if strings.HasPrefix(rest, DelimsDirective) {
+			return rest[len(DelimsDirective):], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFileDelims(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		left, right string
+		body        string
+	}{
+		{"none", "x {{.K}}\n", "{{", "}}", "x {{.K}}\n"},
+		{"slashes", "// gemp:delims /*{{ }}*/\nx\n", "/*{{", "}}*/", "\nx\n"},
+		{"hash", "# gemp:delims <% %>\nx\n", "<%", "%>", "\nx\n"},
+		{"block comment", "/* gemp:delims [[ ]] */\nx\n", "[[", "]]", "\nx\n"},
+		{"indented, unspaced", "\t//gemp:delims [[ ]]\nx\n", "[[", "]]", "\nx\n"},
+		{"only line", "# gemp:delims [[ ]]", "[[", "]]", ""},
+
+		// Not opening a comment
+		{"in string", "s := \"gemp:delims [[ ]]\"\n", "{{", "}}", "s := \"gemp:delims [[ ]]\"\n"},
+		{"after code", "x := 1 // gemp:delims [[ ]]\n", "{{", "}}", "x := 1 // gemp:delims [[ ]]\n"},
+		{"later in comment", "// see gemp:delims [[ ]]\n", "{{", "}}", "// see gemp:delims [[ ]]\n"},
+		{"second line", "x\n// gemp:delims [[ ]]\n", "{{", "}}", "x\n// gemp:delims [[ ]]\n"},
+	}
+	g := &Generator{opts: Options{LeftDelim: DefaultLeftDelim, RightDelim: DefaultRightDelim}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, right, body, err := g.fileDelims("t", tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if left != tt.left || right != tt.right || body != tt.body {
+				t.Errorf("got %q %q %q, want %q %q %q", left, right, body, tt.left, tt.right, tt.body)
+			}
+		})
+	}
+}
+
+func TestFileDelimsMissing(t *testing.T) {
+	g := &Generator{opts: Options{LeftDelim: DefaultLeftDelim, RightDelim: DefaultRightDelim}}
+	_, _, _, err := g.fileDelims("t", "// gemp:delims [[\n")
+	var parseErr *TemplateParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 {
+		t.Errorf("got error %v, want TemplateParseError at line 1", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Dialects of template files, selected by Options.Dialect.
+const (
+	// Go's text/template syntax alone.
+	DialectTemplate = "template"
+
+	// Placeholders which are themselves valid Go, so that a template
+	// compiles, and may be formatted and vetted, as-is:
+	//
+	//	GEMP_Key              an identifier, replaced by the Value of Key
+	//	/*GEMP:Key*/ default  a comment marker, replaced along with the
+	//	                      identifier, qualified identifier, number or
+	//	                      string literal following it, as gofmt spaces it
+	//	... // gemp:omit      a line expanded as an empty line, e.g. the
+	//	                      declaration of a GEMP_Key identifier
+	//
+	// Template actions remain available alongside, with the file's
+	// delimiters.
+	DialectToken = "token"
+)
+
+// Dialects lists the valid values of Options.Dialect.
+var Dialects = []string{DialectTemplate, DialectToken}
+
+// OmitDirective marks a line of a DialectToken template to be expanded as an
+// empty line.
+const OmitDirective = "gemp:omit"
+
+var placeholderRE = regexp.MustCompile(
+	`/\*GEMP:(\w+)\*/[ \t]*(?:"(?:[^"\\\n]|\\.)*"|[\w.]+)|\bGEMP_(\w+)`)
+
+// translateTokens rewrites each placeholder of DialectToken 'text' as a
+// template action with delimiters 'left' and 'right'.  Line count is
+// preserved.
+func translateTokens(text, left, right string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, OmitDirective) {
+			lines[i] = line[len(strings.TrimSuffix(line, "\n")):]
+			continue
+		}
+		lines[i] = placeholderRE.ReplaceAllStringFunc(line, func(placeholder string) string {
+			m := placeholderRE.FindStringSubmatch(placeholder)
+			key := m[1]
+			if key == "" {
+				key = m[2]
+			}
+			return left + "." + key + right
+		})
+	}
+	return strings.Join(lines, "")
+}
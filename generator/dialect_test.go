@@ -0,0 +1,80 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTranslateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"identifier", "var x GEMP_T\n", "var x {{.T}}\n"},
+		{"identifiers", "GEMP_A(GEMP_B)\n", "{{.A}}({{.B}})\n"},
+		{"underscored Key", "x := GEMP_Uint_Size\n", "x := {{.Uint_Size}}\n"},
+		{"within identifier", "xGEMP_T GEMP_Tx\n", "xGEMP_T {{.Tx}}\n"},
+		{"marker and number", "n := /*GEMP:N*/ 8\n", "n := {{.N}}\n"},
+		{"marker unspaced", "n := /*GEMP:N*/8 + 1\n", "n := {{.N}} + 1\n"},
+		{"marker and qualified", "var t /*GEMP:T*/ bits.UintSize\n", "var t {{.T}}\n"},
+		{"marker and float", "f := /*GEMP:F*/ 1.5\n", "f := {{.F}}\n"},
+		{"marker and string", `s := /*GEMP:S*/ "a \"b\""` + "\n", "s := {{.S}}\n"},
+		{"marker alone", "/*GEMP:S*/\n", "/*GEMP:S*/\n"},
+		{"omit", "const GEMP_T = 0 // gemp:omit\nvar x GEMP_T\n", "\nvar x {{.T}}\n"},
+		{"omit last line", "a\nb // gemp:omit", "a\n"},
+		{"action kept", "{{if .X}}GEMP_T{{end}}\n", "{{if .X}}{{.T}}{{end}}\n"},
+		{"no placeholder", "GEMP:T GEMP\n", "GEMP:T GEMP\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translateTokens(tt.text, "{{", "}}"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateTokensDelims(t *testing.T) {
+	got := translateTokens("x := GEMP_T\n", "/*{{", "}}*/")
+	if want := "x := /*{{.T}}*/\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTokenDialectExpansion(t *testing.T) {
+	g, err := New(Options{
+		TemplatePaths: []string{"out.go"},
+		TemplateText: `package p
+
+const GEMP_N = 0 // gemp:omit
+const n = GEMP_N
+var s = /*GEMP:S*/ "placeholder"
+`,
+		KvpArgs: []KvpArg{
+			{Key: "N", Values: []string{"8"}},
+			{Key: "S", Values: []string{`"x"`}},
+		},
+		Dialect:   DialectToken,
+		OutTopDir: t.TempDir(),
+		Logger:    quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := g.files[0].tmpl.Execute(&out, g.combinations()[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := `package p
+
+
+const n = 8
+var s = "x"
+`
+	if got, _, _ := resolveLineMarkers(out.Bytes(), "out.go"); string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severities of a line count disagreement, selected by Options.LineCheck.
+const (
+	LineCheckOff   = "off"
+	LineCheckWarn  = "warn"
+	LineCheckError = "error"
+)
+
+// LineChecks lists the valid values of Options.LineCheck.
+var LineChecks = []string{LineCheckOff, LineCheckWarn, LineCheckError}
+
+// LineDrift locates the first span of template lines whose expansion spans
+// a different number of output lines.
+type LineDrift struct {
+	Line       int      // of template, of Action
+	Action     string   // most likely culprit, as written in the template; "" if none found
+	TemplLines int      // spanned in the template, from the start of Line
+	OutLines   int      // spanned by their expansion
+	Keys       []string // those referenced by Action whose Values hold a newline
+	Repeated   int      // template line expanded anew, as by a loop; 0 if none
+}
+
+func (d *LineDrift) String() string {
+	s := fmt.Sprintf("%d template line(s) expanded to %d", d.TemplLines, d.OutLines)
+	if d.Repeated > 0 {
+		s = fmt.Sprintf("template line %d expanded more than once", d.Repeated)
+	}
+	if d.Action != "" {
+		s = fmt.Sprintf("'%s': ", d.Action) + s
+	}
+	if len(d.Keys) > 0 {
+		s += fmt.Sprintf("; Value of %s holds a newline", strings.Join(d.Keys, ", "))
+	}
+	return s
+}
+
+// findDrift finds the first drift in the expansion of 'tf' with 'bindings',
+// given the origin of each line of output and the line markers seen.
+func findDrift(tf *templateFile, marks []lineMark, bindings map[string]interface{}) *LineDrift {
+	// X  A virtual mark begins line 1 of both.
+	prev := lineMark{outLine: 1, origin: lineOrigin{tf.path, 1}}
+	for _, mark := range marks {
+		if mark.origin.path != tf.path {
+			continue
+		}
+		templLines := mark.origin.line - prev.origin.line
+		if outLines := mark.outLine - prev.outLine; outLines != templLines {
+			return newDrift(tf, prev.origin.line, mark.origin.line, outLines, bindings)
+		}
+		prev = mark
+	}
+	return nil
+}
+
+var actionKeyRE = regexp.MustCompile(`\.(\w+)`)
+
+// newDrift blames an action begun within template lines [from, to) of
+// 'tf', preferring one referencing a Key whose Value holds a newline, or
+// else one itself spanning lines.
+func newDrift(tf *templateFile, from, to, outLines int, bindings map[string]interface{}) *LineDrift {
+	drift := &LineDrift{Line: from, TemplLines: to - from, OutLines: outLines}
+	actions := templateActions(tf.parsed, tf.leftDelim, tf.rightDelim)
+	if to <= from {
+		// X  Output has returned to an earlier template line:  blame the
+		//    nearest loop begun before it.
+		drift.Repeated = to
+		for _, action := range actions {
+			keyword := strings.TrimLeft(action.text[len(tf.leftDelim):], "- \t\r\n")
+			if action.line <= to && strings.HasPrefix(keyword, "range") {
+				drift.Line, drift.Action = action.line, elide(action.text)
+			}
+		}
+		return drift
+	}
+	var multiLine *templateAction
+	for _, action := range actions {
+		if action.line < from || action.line >= to {
+			continue
+		}
+		var keys []string
+		for _, m := range actionKeyRE.FindAllStringSubmatch(action.text, -1) {
+			if v, ok := bindings[m[1]]; ok && strings.Contains(fmt.Sprint(v), "\n") {
+				keys = append(keys, m[1])
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			drift.Line, drift.Action, drift.Keys = action.line, elide(action.text), keys
+			return drift
+		}
+		if drift.Action == "" {
+			drift.Line, drift.Action = action.line, action.text
+		}
+		if multiLine == nil && strings.Contains(action.text, "\n") {
+			a := action
+			multiLine = &a
+		}
+	}
+	if multiLine != nil && outLines < drift.TemplLines {
+		drift.Line, drift.Action = multiLine.line, multiLine.text
+	}
+	drift.Action = elide(drift.Action)
+	return drift
+}
+
+type templateAction struct {
+	line int
+	text string // including delimiters
+}
+
+// templateActions lists the actions of 'text', set off by 'leftDelim' and
+// 'rightDelim'.
+func templateActions(text, leftDelim, rightDelim string) (actions []templateAction) {
+	for off := 0; ; {
+		start := strings.Index(text[off:], leftDelim)
+		if start < 0 {
+			return
+		}
+		start += off
+		end := strings.Index(text[start+len(leftDelim):], rightDelim)
+		if end < 0 {
+			return
+		}
+		end += start + len(leftDelim) + len(rightDelim)
+		actions = append(actions, templateAction{
+			line: strings.Count(text[:start], "\n") + 1,
+			text: text[start:end],
+		})
+		off = end
+	}
+}
+
+// elide shortens a multi-line or long action for display on one line.
+func elide(action string) string {
+	const max = 60
+	if i := strings.IndexByte(action, '\n'); i >= 0 {
+		action = action[:i] + "..."
+	}
+	if len(action) > max {
+		action = action[:max] + "..."
+	}
+	return action
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmullis/gemp/internal"
+)
+
+type (
+	// TemplateParseError reports a template that text/template could not parse.
+	TemplateParseError struct {
+		TemplatePath string
+		Line         int // 0 if not known
+		Err          error
+	}
+
+	// TemplateExecError reports failure of template.Execute() for one
+	// combination of values.
+	TemplateExecError struct {
+		TemplatePath string
+		Line         int // 0 if not known
+		Combination  map[string]interface{}
+		Err          error
+	}
+
+	// PathCollisionError reports an output pathname that already exists,
+	// either from an earlier run (without 'Clobber'), or from an earlier
+	// combination of this run.
+	PathCollisionError struct {
+		TemplatePath string
+		OutPath      string
+		Combination  map[string]interface{}
+		ThisRun      bool
+	}
+
+	// LineCountError reports an output file whose line count differs from
+	// that of its template, or a partial whose output differs in line count
+	// from its body.
+	LineCountError struct {
+		TemplatePath string
+		Partial      string // name of {{define}} or {{block}}, if a partial
+		OutPath      string
+		Combination  map[string]interface{}
+		TemplLines   int
+		OutLines     int
+		Drift        *LineDrift // nil if not found
+	}
+
+	// FormatError reports output that Options.GoFormat or one of
+	// Options.Formatters failed to format.  Line, of output, is also that of
+	// the template, given the line-preservation tenet.
+	FormatError struct {
+		TemplatePath string
+		Line         int // 0 if not known
+		OutPath      string
+		Combination  map[string]interface{}
+		Err          error
+	}
+
+	// FilterError reports a malformed Where or Exclude expression.
+	FilterError struct {
+		Expr   string
+		Column int // 1-based, in bytes
+		Reason string
+	}
+
+	// LockstepError reports a malformed group of Lockstep Keys.
+	LockstepError struct {
+		Keys   []string
+		Reason string
+	}
+)
+
+func (e *TemplateParseError) Error() string {
+	return fmt.Sprintf("%s: template parse failed: %v",
+		position(e.TemplatePath, e.Line), e.Err)
+}
+
+func (e *TemplateParseError) Unwrap() error { return e.Err }
+
+func (e *TemplateExecError) Error() string {
+	return fmt.Sprintf("%s: template execution failed: %v\nContents of failing map:\n%s",
+		position(e.TemplatePath, e.Line), e.Err, FormatMap(e.Combination))
+}
+
+func (e *TemplateExecError) Unwrap() error { return e.Err }
+
+func (e *PathCollisionError) Error() string {
+	if e.ThisRun {
+		return fmt.Sprintf("%s: output path '%s' generated by more than one combination; last was:\n%s",
+			e.TemplatePath, e.OutPath, FormatMap(e.Combination))
+	}
+	return fmt.Sprintf("%s: output file already exists: '%s'",
+		e.TemplatePath, e.OutPath)
+}
+
+func (e *LineCountError) Error() string {
+	if e.Partial != "" {
+		return fmt.Sprintf("%s: partial \"%s\": outLines(%d) != bodyLines(%d), outPath=%s, combination:\n%s",
+			e.TemplatePath, e.Partial, e.OutLines, e.TemplLines, e.OutPath, FormatMap(e.Combination))
+	}
+	if e.Drift != nil {
+		return fmt.Sprintf("%s: outLines(%d) != templLines(%d), outPath=%s\n%s: first drift: %v\ncombination:\n%s",
+			e.TemplatePath, e.OutLines, e.TemplLines, e.OutPath,
+			position(e.TemplatePath, e.Drift.Line), e.Drift, FormatMap(e.Combination))
+	}
+	return fmt.Sprintf("%s: outLines(%d) != templLines(%d), outPath=%s, combination:\n%s",
+		e.TemplatePath, e.OutLines, e.TemplLines, e.OutPath, FormatMap(e.Combination))
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("%s: formatting of output failed: %v, outPath=%s, combination:\n%s",
+		position(e.TemplatePath, e.Line), e.Err, e.OutPath, FormatMap(e.Combination))
+}
+
+func (e *FormatError) Unwrap() error { return e.Err }
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("filter expression, column %d: %s: \"%s\"",
+		e.Column, e.Reason, e.Expr)
+}
+
+func (e *LockstepError) Error() string {
+	return fmt.Sprintf("lockstep group %s: %s",
+		strings.Join(e.Keys, internal.ValueListSeparator), e.Reason)
+}
+
+func position(path string, line int) string {
+	if line <= 0 {
+		return path
+	}
+	return path + ":" + strconv.Itoa(line)
+}
+
+// X  text/template reports position only within the text of its error, as
+// "template: NAME:LINE: ..." or "template: NAME:LINE:COL: executing ...".
+var templateErrLineRE = regexp.MustCompile(`^template: .*?:(\d+):`)
+
+func templateErrLine(err error) int {
+	m := templateErrLineRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// FormatMap renders a combination map one K=V per line, sorted by Key.
+func FormatMap(m map[string]interface{}) (out string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m[k]
+		out += fmt.Sprintf("   % 20s %15T '%v'\n", k, v, v)
+	}
+	return
+}
@@ -0,0 +1,373 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter expressions select combinations of values for generation, per
+// this grammar:
+//
+//	expr     = and { "||" and } .
+//	and      = unary { "&&" unary } .
+//	unary    = "!" unary | "(" expr ")" | operand relation .
+//	relation = ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand
+//	         | "in" "(" operand { "," operand } ")" .
+//	operand  = Key | number | "double-quoted string" | "true" | "false" .
+//
+// A Key named "true" or "false" shadows the literal.  Two numbers compare
+// numerically; anything else compares as strings.
+
+type (
+	filterExpr interface {
+		eval(combination map[string]interface{}) bool
+	}
+
+	// filterOperand is either a Key, resolved per combination, or a literal.
+	filterOperand struct {
+		key   string
+		value interface{} // int, float64, string or bool, if not a Key
+	}
+
+	filterNot struct{ x filterExpr }
+
+	filterBinary struct {
+		op   string // "&&" or "||"
+		x, y filterExpr
+	}
+
+	filterCompare struct {
+		op   string
+		x, y filterOperand
+	}
+
+	filterIn struct {
+		x    filterOperand
+		list []filterOperand
+	}
+
+	filterToken struct {
+		pos  int // byte offset within expression
+		kind rune
+		text string
+	}
+
+	filterParser struct {
+		expr   string
+		keys   map[string]bool
+		tokens []filterToken
+		next   int
+	}
+)
+
+// Kinds of filterToken other than operators, which are their own text.
+const (
+	tokEOF    = 'E'
+	tokIdent  = 'I'
+	tokNumber = 'N'
+	tokString = 'S'
+)
+
+func (o filterOperand) resolve(combination map[string]interface{}) interface{} {
+	if o.key != "" {
+		return combination[o.key]
+	}
+	return o.value
+}
+
+func (e *filterNot) eval(combination map[string]interface{}) bool {
+	return !e.x.eval(combination)
+}
+
+func (e *filterBinary) eval(combination map[string]interface{}) bool {
+	if e.op == "&&" {
+		return e.x.eval(combination) && e.y.eval(combination)
+	}
+	return e.x.eval(combination) || e.y.eval(combination)
+}
+
+func (e *filterCompare) eval(combination map[string]interface{}) bool {
+	c := compareValues(e.x.resolve(combination), e.y.resolve(combination))
+	switch e.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // ">="
+		return c >= 0
+	}
+}
+
+func (e *filterIn) eval(combination map[string]interface{}) bool {
+	x := e.x.resolve(combination)
+	for _, o := range e.list {
+		if compareValues(x, o.resolve(combination)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues returns -1, 0 or +1 as 'a' is less than, equal to, or greater
+// than 'b'.
+func compareValues(a, b interface{}) int {
+	if aInt, ok := a.(int); ok {
+		if bInt, ok := b.(int); ok {
+			return compareOrdered(aInt < bInt, aInt > bInt)
+		}
+	}
+	if aNum, ok := toFloat(a); ok {
+		if bNum, ok := toFloat(b); ok {
+			return compareOrdered(aNum < bNum, aNum > bNum)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// parseFilter compiles 'expr', each of whose Keys must be one of 'kvpArgs'.
+// An empty 'expr' yields nil.
+func parseFilter(expr string, kvpArgs []KvpArg) (filterExpr, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	p := &filterParser{expr: expr, keys: make(map[string]bool, len(kvpArgs))}
+	for _, kvp := range kvpArgs {
+		p.keys[kvp.Key] = true
+	}
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorAt(t, "unexpected '%s'", t.text)
+	}
+	return e, nil
+}
+
+func (p *filterParser) errorAt(t filterToken, format string, a ...interface{}) error {
+	return &FilterError{Expr: p.expr, Column: t.pos + 1, Reason: fmt.Sprintf(format, a...)}
+}
+
+func (p *filterParser) scan() error {
+	s := p.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '_' || isLetter(c):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || isLetter(s[j]) || isDigit(s[j])) {
+				j++
+			}
+			p.tokens = append(p.tokens, filterToken{i, tokIdent, s[i:j]})
+			i = j
+		case isDigit(c) || (c == '-' && i+1 < len(s) && isDigit(s[i+1])):
+			j := i + 1
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, filterToken{i, tokNumber, s[i:j]})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return &FilterError{Expr: s, Column: i + 1, Reason: "unterminated string"}
+			}
+			p.tokens = append(p.tokens, filterToken{i, tokString, s[i : j+1]})
+			i = j + 1
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||",
+				"<", ">", "!", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return &FilterError{Expr: s, Column: i + 1,
+					Reason: fmt.Sprintf("unexpected character '%c'", c)}
+			}
+			p.tokens = append(p.tokens, filterToken{i, rune(op[0]), op})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, filterToken{len(s), tokEOF, "end of expression"})
+	return nil
+}
+
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool  { return '0' <= c && c <= '9' }
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) advance() filterToken {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token if its text is 'text'.
+func (p *filterParser) accept(text string) bool {
+	if t := p.peek(); t.kind != tokString && t.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return p.errorAt(t, "expected '%s', found '%s'", text, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var y filterExpr
+		if y, err = p.parseAnd(); err == nil {
+			x = &filterBinary{"||", x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	x, err := p.parseUnary()
+	for err == nil && p.accept("&&") {
+		var y filterExpr
+		if y, err = p.parseUnary(); err == nil {
+			x = &filterBinary{"&&", x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{x}, nil
+	}
+	if p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	}
+
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.advance()
+	switch {
+	case t.kind == tokIdent && t.text == "in":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		e := &filterIn{x: x}
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			e.list = append(e.list, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return e, p.expect(")")
+	case t.kind != tokString && strings.Contains(" == != < <= > >= ", " "+t.text+" "):
+		y, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &filterCompare{t.text, x, y}, nil
+	}
+	return nil, p.errorAt(t, "expected comparison or 'in', found '%s'", t.text)
+}
+
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokIdent:
+		if p.keys[t.text] {
+			return filterOperand{key: t.text}, nil
+		}
+		switch t.text {
+		case "true":
+			return filterOperand{value: true}, nil
+		case "false":
+			return filterOperand{value: false}, nil
+		}
+		return filterOperand{}, p.errorAt(t, "unknown Key '%s'", t.text)
+	case tokNumber:
+		if n, err := strconv.Atoi(t.text); err == nil {
+			return filterOperand{value: n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return filterOperand{}, p.errorAt(t, "malformed number %s", t.text)
+		}
+		return filterOperand{value: f}, nil
+	case tokString:
+		s, err := strconv.Unquote(t.text)
+		if err != nil {
+			return filterOperand{}, p.errorAt(t, "malformed string %s", t.text)
+		}
+		return filterOperand{value: s}, nil
+	}
+	return filterOperand{}, p.errorAt(t, "expected Key, number or string, found '%s'", t.text)
+}
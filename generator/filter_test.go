@@ -0,0 +1,150 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"errors"
+	"testing"
+)
+
+var filterKeys = []KvpArg{{Key: "I"}, {Key: "U"}, {Key: "F"}, {Key: "S"}, {Key: "B"}, {Key: "N"}}
+
+// filterCombination binds each of filterKeys to a value of a distinct type.
+var filterCombination = map[string]interface{}{
+	"I": 8,
+	"U": uint(16),
+	"F": 2.5,
+	"S": "abc",
+	"B": true,
+	"N": -3,
+}
+
+func TestFilterEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`I == 8`, true},
+		{`I != 8`, false},
+		{`I < 9 && I <= 8 && I > 7 && I >= 8`, true},
+		{`8 == I`, true},
+
+		// Precedence, grouping and negation
+		{`I == 1 || I == 8 && S == "abc"`, true},
+		{`(I == 1 || I == 8) && S == "x"`, false},
+		{`I == 1 || (I == 8 && S == "x")`, false},
+		{`!I == 8`, false},
+		{`!(I == 1)`, true},
+		{`!!(I == 8)`, true},
+		{`! I == 1 && S == "abc"`, true},
+
+		// Set membership
+		{`I in (1, 2, 8)`, true},
+		{`I in (1)`, false},
+		{`S in ("x", "abc")`, true},
+		{`!(S in ("x"))`, true},
+		{`I in (U, F, 8)`, true},
+
+		// Negative numbers
+		{`N == -3`, true},
+		{`N < 0 && N > -4`, true},
+		{`N in (-1, -3)`, true},
+		{`-3 == N`, true},
+
+		// Mixed numeric types compare numerically
+		{`U == 16`, true},
+		{`U > I`, true},
+		{`F < 3`, true},
+		{`F > 2.4 && F <= 2.5`, true},
+		{`I > F`, true},
+		{`U == 16.0`, true},
+		{`10 > 9`, true},
+
+		// Bool literals
+		{`B == true`, true},
+		{`B != false`, true},
+		{`true == B && !(B == false)`, true},
+		{`B in (false, true)`, true},
+		{`false < true`, true},
+		{`I == true`, false},
+
+		// Anything else compares as strings
+		{`S > "abb"`, true},
+		{`S < "b"`, true},
+		{`I == "8"`, true},
+		{`I < "10"`, false},
+		{`B == "true"`, true},
+		{`S != 1`, true},
+		{`"10" < "9"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := parseFilter(tt.expr, filterKeys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.eval(filterCombination); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterEmpty(t *testing.T) {
+	for _, expr := range []string{"", "  \t"} {
+		if e, err := parseFilter(expr, filterKeys); e != nil || err != nil {
+			t.Errorf("'%s': got %v, %v, want nil, nil", expr, e, err)
+		}
+	}
+}
+
+func TestFilterParseErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		column int
+		reason string
+	}{
+		{`X == 1`, 1, "unknown Key 'X'"},
+		{`I == Y`, 6, "unknown Key 'Y'"},
+		{`I = 1`, 3, "unexpected character '='"},
+		{`I == 1 $`, 8, "unexpected character '$'"},
+		{`S == "abc`, 6, "unterminated string"},
+		{`I == 1.2.3`, 6, "malformed number 1.2.3"},
+		{`I`, 2, "expected comparison or 'in', found 'end of expression'"},
+		{`I S`, 3, "expected comparison or 'in', found 'S'"},
+		{`I ==`, 5, "expected Key, number or string, found 'end of expression'"},
+		{`I == )`, 6, "expected Key, number or string, found ')'"},
+		{`(I == 1`, 8, "expected ')', found 'end of expression'"},
+		{`I == 1)`, 7, "unexpected ')'"},
+		{`I == 1 S == "x"`, 8, "unexpected 'S'"},
+		{`I in 1`, 6, "expected '(', found '1'"},
+		{`I in (1 2)`, 9, "expected ')', found '2'"},
+		{`I in ()`, 7, "expected Key, number or string, found ')'"},
+		{`B == True`, 6, "unknown Key 'True'"},
+		{`I == 1 &&`, 10, "expected Key, number or string, found 'end of expression'"},
+		{`!`, 2, "expected Key, number or string, found 'end of expression'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseFilter(tt.expr, filterKeys)
+			var filterErr *FilterError
+			if !errors.As(err, &filterErr) {
+				t.Fatalf("got error %v, want FilterError", err)
+			}
+			if filterErr.Column != tt.column || filterErr.Reason != tt.reason {
+				t.Errorf("got column %d: %s, want column %d: %s",
+					filterErr.Column, filterErr.Reason, tt.column, tt.reason)
+			}
+		})
+	}
+}
+
+func TestFilterKeyShadowsLiteral(t *testing.T) {
+	e, err := parseFilter(`true == "yes"`, []KvpArg{{Key: "true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.eval(map[string]interface{}{"true": "yes"}) {
+		t.Error("Key 'true' not resolved")
+	}
+}
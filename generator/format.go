@@ -0,0 +1,71 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// formatterFor returns the formatter of output file 'outPath', or nil if
+// none.  Options.Formatters takes precedence over Options.GoFormat.
+func (g *Generator) formatterFor(outPath string) func([]byte) ([]byte, int, error) {
+	ext := filepath.Ext(outPath)
+	if command, ok := g.opts.Formatters[ext]; ok {
+		return func(src []byte) ([]byte, int, error) {
+			return runFormatter(command, src)
+		}
+	}
+	if g.opts.GoFormat && ext == ".go" {
+		return goFormat
+	}
+	return nil
+}
+
+// goFormat formats 'src' as does gofmt, returning on failure the line of
+// the first error.
+func goFormat(src []byte) ([]byte, int, error) {
+	out, err := format.Source(src)
+	if err != nil {
+		var list scanner.ErrorList
+		if errors.As(err, &list) && len(list) > 0 {
+			return nil, list[0].Pos.Line, list[0]
+		}
+		return nil, 0, err
+	}
+	return out, 0, nil
+}
+
+// errLineRE finds a line number within a formatter's diagnostic, as in
+// "<standard input>:12:3: ..." or "stdin:12: ...".
+var errLineRE = regexp.MustCompile(`:(\d+):`)
+
+// runFormatter pipes 'src' through 'command', run by 'sh -c', returning its
+// stdout.  On failure, returns any line number found in its stderr.
+func runFormatter(command string, src []byte) ([]byte, int, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		diagnostic := strings.TrimSpace(stderr.String())
+		line := 0
+		if m := errLineRE.FindStringSubmatch(diagnostic); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		if diagnostic == "" {
+			return nil, line, fmt.Errorf("'%s': %w", command, err)
+		}
+		return nil, line, fmt.Errorf("'%s': %w: %s", command, err, diagnostic)
+	}
+	return stdout.Bytes(), 0, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFormatterFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		goFormat   bool
+		formatters map[string]string
+		outPath    string
+		want       string // of formatting "package p;var  x=1\n"
+	}{
+		{"none", false, nil, "a.go", ""},
+		{"gofmt", true, nil, "a.go", "package p\n\nvar x = 1\n"},
+		{"gofmt of other extension", true, nil, "a.txt", ""},
+		{"formatter", false, map[string]string{".txt": "tr a-z A-Z"}, "a.txt", "PACKAGE P;VAR  X=1\n"},
+		{"formatter over gofmt", true, map[string]string{".go": "tr a-z A-Z"}, "a.go", "PACKAGE P;VAR  X=1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Generator{opts: Options{GoFormat: tt.goFormat, Formatters: tt.formatters}}
+			format := g.formatterFor(tt.outPath)
+			if format == nil {
+				if tt.want != "" {
+					t.Fatal("no formatter")
+				}
+				return
+			}
+			if tt.want == "" {
+				t.Fatal("unexpected formatter")
+			}
+			got, _, err := format([]byte("package p;var  x=1\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoFormatErrorLine(t *testing.T) {
+	_, line, err := goFormat([]byte("package p\n\nfunc f() {\n\tx := \n}\n"))
+	if err == nil || line != 5 {
+		t.Errorf("got line %d, error %v, want an error at line 5", line, err)
+	}
+}
+
+func TestRunFormatterErrors(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	tests := []struct {
+		command string
+		line    int
+		message string
+	}{
+		{"echo '<standard input>:12:3: expected x' >&2; exit 2", 12, "expected x"},
+		{"echo 'stdin:7: bad' >&2; exit 1", 7, "stdin:7: bad"},
+		{"echo 'no position' >&2; exit 1", 0, "no position"},
+		{"exit 3", 0, "exit status 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			_, line, err := runFormatter(tt.command, []byte("x\n"))
+			if err == nil || line != tt.line || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("got line %d, error %v, want line %d, error containing %s",
+					line, err, tt.line, tt.message)
+			}
+		})
+	}
+}
+
+func TestGoFormatExpansion(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+		line int // of template, if formatting fails
+	}{
+		{"formatted", "package p\nvar  x={{.N}}\n", "package p\n\nvar x = 8\n", 0},
+		{"failing", "package p\n\n\nvar x = {{.N}} +\n", "", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New(Options{
+				TemplatePaths: []string{"out.go"},
+				TemplateText:  tt.text,
+				KvpArgs:       []KvpArg{{Key: "N", Values: []string{"8"}}},
+				GoFormat:      true,
+				LineCheck:     LineCheckOff,
+				OutTopDir:     t.TempDir(),
+				Logger:        quietLogger,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := g.ExpandTemplate()
+			if tt.line != 0 {
+				var formatErr *FormatError
+				if !errors.As(err, &formatErr) || formatErr.Line != tt.line {
+					t.Errorf("got error %v, want FormatError at line %d", err, tt.line)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(results[0].OutPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Funcs returns the functions available to every template, beyond those
+// built into text/template.  Each call returns a new map, which callers
+// may extend.  Argument order suits pipelines: the operand comes last,
+// as in '{{.Ops | join ", "}}'.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		// Case conversions
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"camel":      camel,
+		"snake":      func(s string) string { return joinWords(words(s), "_", strings.ToLower) },
+		"kebab":      func(s string) string { return joinWords(words(s), "-", strings.ToLower) },
+		"exported":   exported,
+		"unexported": unexported,
+
+		// Arithmetic on integers
+		"add": func(a, b interface{}) (int, error) { return arith("add", a, b) },
+		"sub": func(a, b interface{}) (int, error) { return arith("sub", a, b) },
+		"mul": func(a, b interface{}) (int, error) { return arith("mul", a, b) },
+		"div": func(a, b interface{}) (int, error) { return arith("div", a, b) },
+		"mod": func(a, b interface{}) (int, error) { return arith("mod", a, b) },
+		"shl": func(a, b interface{}) (int, error) { return arith("shl", a, b) },
+		"shr": func(a, b interface{}) (int, error) { return arith("shr", a, b) },
+
+		// Strings
+		"join":       join,
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+
+		// Numeric formatting
+		"hex":    hexLiteral,
+		"padded": padded,
+	}
+}
+
+// words splits 's' into words at each non-alphanumeric character, and at
+// each change of case marking the start of a word, as in "HTTPServer" or
+// "reverseBytes".  Digits remain with the preceding word, as in "uint64".
+func words(s string) (ws []string) {
+	runes := []rune(s)
+	start := -1
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				ws = append(ws, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+		prev := runes[i-1]
+		if unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+			unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			ws = append(ws, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start >= 0 {
+		ws = append(ws, string(runes[start:]))
+	}
+	return
+}
+
+func joinWords(ws []string, sep string, f func(string) string) string {
+	for i, w := range ws {
+		ws[i] = f(w)
+	}
+	return strings.Join(ws, sep)
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+// camel converts e.g. "reverse_bytes" or "ReverseBytes" to "reverseBytes".
+func camel(s string) string {
+	ws := words(s)
+	for i, w := range ws {
+		w = strings.ToLower(w)
+		if i > 0 {
+			w = upperFirst(w)
+		}
+		ws[i] = w
+	}
+	return strings.Join(ws, "")
+}
+
+// exported converts 's' to an exported Go identifier, capitalizing each
+// word but otherwise preserving case, e.g. "uint64 reverse" to
+// "Uint64Reverse".
+func exported(s string) string {
+	return joinWords(words(s), "", upperFirst)
+}
+
+// unexported converts 's' to an unexported Go identifier, as does
+// 'exported' but with its first word lowercased, e.g. "HTTPServer" to
+// "httpServer".
+func unexported(s string) string {
+	ws := words(s)
+	for i := range ws {
+		if i == 0 {
+			ws[i] = strings.ToLower(ws[i])
+		} else {
+			ws[i] = upperFirst(ws[i])
+		}
+	}
+	return strings.Join(ws, "")
+}
+
+// toInt converts any integer, or string of decimal digits, to int.
+func toInt(v interface{}) (int, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); f == float64(int(f)) {
+			return int(f), nil
+		}
+	case reflect.String:
+		if i, err := strconv.Atoi(rv.String()); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("not an integer: %T '%v'", v, v)
+}
+
+func arith(op string, a, b interface{}) (int, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	switch op {
+	case "add":
+		return x + y, nil
+	case "sub":
+		return x - y, nil
+	case "mul":
+		return x * y, nil
+	case "div", "mod":
+		if y == 0 {
+			return 0, fmt.Errorf("%s: division by zero", op)
+		}
+		if op == "div" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "shl", "shr":
+		if y < 0 {
+			return 0, fmt.Errorf("%s: negative shift count %d", op, y)
+		}
+		if op == "shl" {
+			return x << uint(y), nil
+		}
+		return x >> uint(y), nil
+	}
+	panic("arith: unknown op " + op)
+}
+
+// join joins the elements of any slice, each formatted as by fmt.Sprint.
+func join(sep string, list interface{}) (string, error) {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: not a list: %T", list)
+	}
+	elems := make([]string, rv.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
+
+// hexLiteral formats an integer as a Go hexadecimal literal, e.g. 0xff.
+func hexLiteral(v interface{}) (string, error) {
+	i, err := toInt(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%#x", i), nil
+}
+
+// padded formats an integer in decimal, zero-padded to 'width' digits.
+func padded(width int, v interface{}) (string, error) {
+	i, err := toInt(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", width, i), nil
+}
@@ -0,0 +1,597 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+// Package generator recursively expands template files as directed by
+// a common pool of K=V bindings.  It is the engine behind the 'gen'
+// command of gemp, and may be driven directly from go:generate drivers
+// or tests.
+//
+//    Tenets:
+//     1. Don't break runtime's understanding of source code line numbers -- strings
+//        inserted into source code by generation must not include line breaks.
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dmullis/gemp/internal"
+)
+
+// KvpArg binds one Key to its list of one or more Values.
+type KvpArg = internal.KvpArg
+
+const DefaultFormat = "%-.s-%s" // X  replace '+' with '-', Key with Value
+
+type (
+	// Options holds everything needed to expand one template.
+	// Fields left at their zero value take the defaults of the 'gen' command.
+	Options struct {
+		// Template files, directories of them, or glob patterns matching
+		// either.  Each file's path, as given or as found by walking a
+		// directory, also serves as the pattern for naming of its output files.
+		TemplatePaths []string
+		// Template source.  If non-empty, TemplatePaths must name exactly one
+		// file, which is not read.
+		TemplateText string
+
+		// K=V1,V2...Vn pairs, in the order they are to be enumerated.
+		KvpArgs []KvpArg
+		// Filter expressions over the Keys of KvpArgs.  If non-empty, only
+		// combinations satisfying Where, and not satisfying Exclude, are
+		// generated.  See filter.go for the syntax.
+		Where   string
+		Exclude string
+		// Groups of Keys of KvpArgs whose Values advance together, rather
+		// than multiplying.  All Keys of a group must have equally many
+		// Values.  Each group is enumerated as one dimension, in the
+		// position of its first Key within KvpArgs.
+		Lockstep [][]string
+		// Structured data, e.g. as returned by ReadData, merged into the
+		// bindings of every combination.  Its Keys must not collide with
+		// those of KvpArgs.
+		Data map[string]interface{}
+
+		// Take Values of undeclared KvpArg.Type as strings, rather than
+		// as 'int' wherever strconv.Atoi accepts them.
+		NoTypeGuess bool
+
+		// fmt-style format receiving each Key, Value pair for insertion into
+		// output pathnames.  Defaults to DefaultFormat.
+		Format string
+		// Character setting off Keys within TemplatePath, omitted from
+		// output pathnames.
+		InKeySeparator string
+		// Root of the output tree.  Defaults to ".".
+		OutTopDir string
+		// Overwrite already-existing output files.
+		Clobber bool
+		// If non-empty, name of a manifest of all output files, written by
+		// ExpandTemplate below OutTopDir.
+		ManifestName string
+
+		// Delimiters of template actions, unless overridden by a
+		// DelimsDirective.  Default to DefaultLeftDelim and
+		// DefaultRightDelim.
+		LeftDelim, RightDelim string
+
+		// One of Dialects.  Defaults to DialectTemplate.
+		Dialect string
+
+		// Files, directories or globs of templates parsed into the set of
+		// each template file, for invocation by {{template "name" .}}, or to
+		// override a {{block}}.  Not themselves expanded.  The output of
+		// each partial must span as many lines as its body.
+		Includes []string
+
+		// One of LineModes.  Defaults to LineModeStrict.
+		LineMode string
+
+		// One of LineChecks:  whether a disagreement of line count under
+		// LineModeStrict is ignored, logged as a warning, or returned as
+		// LineCountError.  Defaults to LineCheckError.
+		LineCheck string
+
+		// Format each expanded '.go' file as does gofmt, before the check
+		// of its line count.
+		GoFormat bool
+		// Commands formatting expanded files, indexed by extension including
+		// its '.', e.g. ".py": "black -q -".  Each is run by 'sh -c', reading
+		// the file on stdin and writing it formatted to stdout.  Takes
+		// precedence over GoFormat.
+		Formatters map[string]string
+
+		// Number of combinations rendered concurrently.  Defaults to
+		// runtime.GOMAXPROCS(0).
+		Jobs int
+
+		Verbose bool
+		// Destination of warnings and verbose output.  Defaults to log.Default().
+		Logger *log.Logger
+	}
+
+	// Generator expands each of its parsed templates for every combination
+	// of its Options.KvpArgs.
+	Generator struct {
+		opts           Options
+		where, exclude filterExpr
+		// Indices into opts.KvpArgs, one slice per dimension of enumeration
+		dims [][]int
+		// Values of each of opts.KvpArgs, converted to their types
+		values [][]interface{}
+		files  []*templateFile
+		// Set of templates parsed from opts.Includes, cloned for each file
+		base *template.Template
+		// Body of each partial of opts.Includes, indexed by name
+		partials map[string]partialSpan
+		// Of generation, for Builtins.Timestamp
+		timestamp time.Time
+	}
+
+	// templateFile is one input file, whether a template or a file to be
+	// copied through unchanged.
+	templateFile struct {
+		path       string
+		mode       os.FileMode
+		text       string
+		sha256     string // hex
+		isTemplate bool
+		templLines int
+		// Text as parsed, after any directive or dialect translation, with
+		// its action delimiters
+		parsed                string
+		leftDelim, rightDelim string
+
+		// Immutable after compilation of this file.
+		//    https://golang.org/pkg/text/template/#hdr-Arguments
+		tmpl *template.Template
+
+		// Immutable after parsing of command line.
+		// Selects which of 'kvpArgs' is exposed in name of output pathname
+		//splitBaseFile,
+		splitBaseDir []string // split at each 'InKeySeparator'
+	}
+
+	// Result describes one file written by ExpandTemplate.
+	Result struct {
+		TemplatePath   string
+		TemplateSHA256 string // hex
+		OutPath        string
+		Bindings       map[string]interface{}
+		SHA256         string // hex, of content of OutPath
+		Lines          int
+		Copied         bool // not a template, so copied through unchanged
+		Unchanged      bool // OutPath already held this content, so was not written
+	}
+)
+
+// New reads and parses the templates named by opts.
+func New(opts Options) (*Generator, error) {
+	if opts.Format == "" {
+		opts.Format = DefaultFormat
+	}
+	if opts.LeftDelim == "" {
+		opts.LeftDelim = DefaultLeftDelim
+	}
+	if opts.RightDelim == "" {
+		opts.RightDelim = DefaultRightDelim
+	}
+	if opts.Dialect == "" {
+		opts.Dialect = DialectTemplate
+	}
+	if opts.Dialect != DialectTemplate && opts.Dialect != DialectToken {
+		return nil, fmt.Errorf("unknown Dialect '%s', expected one of: %s",
+			opts.Dialect, strings.Join(Dialects, " "))
+	}
+	if opts.LineMode == "" {
+		opts.LineMode = LineModeStrict
+	}
+	if opts.LineMode != LineModeStrict && opts.LineMode != LineModeDirectives {
+		return nil, fmt.Errorf("unknown LineMode '%s', expected one of: %s",
+			opts.LineMode, strings.Join(LineModes, " "))
+	}
+	if opts.LineCheck == "" {
+		opts.LineCheck = LineCheckError
+	}
+	if opts.LineCheck != LineCheckOff && opts.LineCheck != LineCheckWarn &&
+		opts.LineCheck != LineCheckError {
+		return nil, fmt.Errorf("unknown LineCheck '%s', expected one of: %s",
+			opts.LineCheck, strings.Join(LineChecks, " "))
+	}
+	if opts.OutTopDir == "" {
+		opts.OutTopDir = "."
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+
+	g := &Generator{opts: opts}
+	var err error
+	if g.dims, err = dimensions(opts.KvpArgs, opts.Lockstep); err != nil {
+		return nil, err
+	}
+	if g.values, err = typedValues(opts.KvpArgs, opts.NoTypeGuess); err != nil {
+		return nil, err
+	}
+	if err = checkData(opts.Data, opts.KvpArgs); err != nil {
+		return nil, err
+	}
+	if g.timestamp, err = timestamp(); err != nil {
+		return nil, err
+	}
+	if g.where, err = parseFilter(opts.Where, opts.KvpArgs); err != nil {
+		return nil, err
+	}
+	if g.exclude, err = parseFilter(opts.Exclude, opts.KvpArgs); err != nil {
+		return nil, err
+	}
+	includePaths, err := g.parseIncludes()
+	if err != nil {
+		return nil, err
+	}
+	if opts.TemplateText != "" {
+		if len(opts.TemplatePaths) != 1 {
+			return nil, fmt.Errorf("TemplateText requires exactly one of TemplatePaths, found %d",
+				len(opts.TemplatePaths))
+		}
+		tf, err := g.newTemplateFile(opts.TemplatePaths[0], 0440, []byte(opts.TemplateText), false)
+		if err != nil {
+			return nil, err
+		}
+		g.files = append(g.files, tf)
+		return g, nil
+	}
+
+	inPaths, copied, err := walkTemplatePaths(opts.TemplatePaths)
+	if err != nil {
+		return nil, err
+	}
+	included := make(map[string]bool, len(includePaths))
+	for _, includePath := range includePaths {
+		included[includePath] = true
+	}
+	for _, inPath := range inPaths {
+		if included[filepath.Clean(inPath)] {
+			continue
+		}
+		text, mode, err := getTemplate(inPath)
+		if err != nil {
+			return nil, err
+		}
+		tf, err := g.newTemplateFile(inPath, mode, text, copied[inPath])
+		if err != nil {
+			return nil, err
+		}
+		g.files = append(g.files, tf)
+	}
+	return g, nil
+}
+
+// newTemplateFile takes 'text' of file 'templatePath' as a template,
+// unless 'copyThrough'.
+func (g *Generator) newTemplateFile(templatePath string, mode os.FileMode, text []byte,
+	copyThrough bool) (*templateFile, error) {
+
+	tf := &templateFile{
+		path:         templatePath,
+		mode:         mode,
+		text:         string(text),
+		sha256:       hexSum(text),
+		templLines:   countLines(string(text)),
+		splitBaseDir: split(templatePath),
+	}
+	if g.opts.InKeySeparator != "" {
+		tf.splitBaseDir = exciseChar(tf.splitBaseDir, g.opts.InKeySeparator)
+	}
+	if copyThrough {
+		return tf, nil
+	}
+	left, right, body, err := g.fileDelims(templatePath, tf.text)
+	if err != nil {
+		return nil, err
+	}
+	if g.opts.Dialect == DialectToken {
+		body = translateTokens(body, left, right)
+	}
+	tf.isTemplate = true
+
+	tf.parsed, tf.leftDelim, tf.rightDelim = body, left, right
+	tf.tmpl, err = g.parseTemplateSet(templatePath, body, left, right)
+	if err != nil {
+		return nil, &TemplateParseError{
+			TemplatePath: templatePath,
+			Line:         templateErrLine(err),
+			Err:          err,
+		}
+	}
+	return tf, nil
+}
+
+func getTemplate(templatePath string) ([]byte, os.FileMode, error) {
+	templateText, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not read input file \"%s\": %w",
+			templatePath, err)
+	}
+	stat, err := os.Stat(templatePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return templateText, stat.Mode().Perm(), nil
+}
+
+func hexSum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// countLines counts newline-terminated lines.
+func countLines(text string) int {
+	return strings.Count(text, "\n")
+}
+
+// ExpandTemplate writes one output file for each combination of values and
+// each input file, returning a Result for each in order of enumeration.
+// Files already holding their expected content are not rewritten.  Nothing
+// is written if combinations sharing an output path disagree in content.
+func (g *Generator) ExpandTemplate() ([]Result, error) {
+	if err := g.checkCollisions(); err != nil {
+		return nil, err
+	}
+	var results []Result
+	jobs := g.jobs()
+	err := g.runJobs(jobs, g.writeJob, func(j *job) error {
+		if j.isDuplicate() {
+			return nil
+		}
+		results = append(results, j.result)
+		return nil
+	})
+	if err != nil {
+		return results, err
+	}
+	if g.opts.ManifestName != "" {
+		if err := g.writeManifest(results); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func split(path string) []string {
+	keysRE := regexp.MustCompile(`[a-zA-Z0-9_]+|[^a-zA-Z0-9_]+`)
+	return keysRE.FindAllString(path, -1)
+}
+
+func exciseChar(frags []string, inKeySeparator string) []string {
+	//	separatorRE := regexp.MustCompile(`[` + inKeySeparator + `]`)
+	for ifrag := range frags {
+		frags[ifrag] = strings.ReplaceAll(frags[ifrag], inKeySeparator, "")
+	}
+	return frags
+}
+
+// X  Recursion here enumerates the combinations implied by the command-line
+//    arguments K1=V11,V12,... K2=V21,V22,V23,... ...
+//    This recursion is independent of any directory+file hierarchy specified
+//    by 'TemplatePaths'.
+//
+// X  Each combination is a binding set of its own, immutable once enumerated,
+//    so that combinations may be rendered concurrently.
+//
+//  X  Why a map rather than slice of K=V pairs?
+//       =>  Because template.Execute() doesn't understand
+//           the latter -- apparently reliant upon runtime type information.
+//         cf. https://golang.org/pkg/text/template/#Template.Execute
+//  X  Why indexed with base type 'string' rather than some
+//     defined type equivalent e.g. 'Key'?
+//       => Not acceptable to template.Execute():
+//              executing "singleton template" at <.CodeGenWarning>: can't
+//              evaluate field CodeGenWarning in type map[main.Key]string
+//         cf. https://golang.org/pkg/text/template/#hdr-Arguments
+func (g *Generator) combinations() (combos []map[string]interface{}) {
+	bindings := make(map[string]interface{}, len(g.opts.KvpArgs))
+
+	var recurse func(dimIndex int)
+	recurse = func(dimIndex int) {
+		// list of parameter values complete
+		if dimIndex == len(g.dims) {
+			combos = append(combos, copyMap(bindings))
+			return
+		}
+
+		// Iterate from 'min' to 'max' for this 'dimIndex' (and recursion level).
+		// X  All Keys of a lockstep group advance together.
+		dim := g.dims[dimIndex]
+		for valIndex := range g.opts.KvpArgs[dim[0]].Values {
+			for _, argIndex := range dim {
+				bindings[g.opts.KvpArgs[argIndex].Key] = g.values[argIndex][valIndex]
+			}
+			recurse(dimIndex + 1)
+		}
+	}
+	recurse(0)
+	return
+}
+
+// typedValues converts the Values of each of 'kvpArgs' to its declared
+// type, providing template.Execute() with e.g. 'int' rather than 'string'.
+// X  Undeclared types are guessed, unless 'noTypeGuess'.
+func typedValues(kvpArgs []KvpArg, noTypeGuess bool) ([][]interface{}, error) {
+	values := make([][]interface{}, len(kvpArgs))
+	for i, kvp := range kvpArgs {
+		valueType := kvp.Type
+		if valueType == "" && noTypeGuess {
+			valueType = "string"
+		}
+		for _, enumVal := range kvp.Values {
+			v, err := internal.ParseValue(valueType, enumVal)
+			if err != nil {
+				return nil, fmt.Errorf("Key '%s': %w", kvp.Key, err)
+			}
+			values[i] = append(values[i], v)
+		}
+	}
+	return values, nil
+}
+
+// dimensions groups the indices of 'kvpArgs' into dimensions of enumeration:
+// one for each lockstep group, and one for each Key belonging to none.
+func dimensions(kvpArgs []KvpArg, lockstep [][]string) ([][]int, error) {
+	argIndex := make(map[string]int, len(kvpArgs))
+	for i, kvp := range kvpArgs {
+		argIndex[kvp.Key] = i
+	}
+	groupOf := make(map[int]int) // KvpArgs index -> lockstep group index
+	for g, keys := range lockstep {
+		if len(keys) < 2 {
+			return nil, &LockstepError{keys, "group requires at least two Keys"}
+		}
+		for _, key := range keys {
+			i, ok := argIndex[key]
+			if !ok {
+				return nil, &LockstepError{keys, fmt.Sprintf("unknown Key '%s'", key)}
+			}
+			if _, dup := groupOf[i]; dup {
+				return nil, &LockstepError{keys, fmt.Sprintf("Key '%s' in more than one group", key)}
+			}
+			groupOf[i] = g
+			if n, n0 := len(kvpArgs[i].Values), len(kvpArgs[argIndex[keys[0]]].Values); n != n0 {
+				return nil, &LockstepError{keys, fmt.Sprintf("Key '%s' has %d values, but '%s' has %d",
+					key, n, keys[0], n0)}
+			}
+		}
+	}
+
+	var dims [][]int
+	dimOfGroup := make(map[int]int)
+	for i := range kvpArgs {
+		g, grouped := groupOf[i]
+		if !grouped {
+			dims = append(dims, []int{i})
+		} else if d, seen := dimOfGroup[g]; seen {
+			dims[d] = append(dims[d], i)
+		} else {
+			dimOfGroup[g] = len(dims)
+			dims = append(dims, []int{i})
+		}
+	}
+	return dims, nil
+}
+
+func (g *Generator) substituteNames(splits []string, combination map[string]interface{}) (
+	fragmentsSubstituted []string, err error) {
+
+	substitutions := 0
+	for _, field := range splits {
+		val, ok := combination[field]
+		if !ok {
+			fragmentsSubstituted = append(fragmentsSubstituted,
+				field)
+			continue
+		}
+
+		// X  Each Value is rendered as its declared type, e.g. a 'string'
+		//    "007" retains its zeroes, while an 'int' 0x10 becomes "16".
+		fragmentsSubstituted = append(fragmentsSubstituted,
+			fmt.Sprintf(g.opts.Format, field, fmt.Sprint(val)))
+		substitutions++
+	}
+	if substitutions == 0 && len(splits) > 0 {
+		err = fmt.Errorf("WARNING: no substitutions made for pattern %v",
+			splits)
+	}
+	return
+}
+
+// outPath expands the path of input file 'tf', as directed by 'combination',
+// into that of its output file.  Any warning is returned in 'warning'.
+func (g *Generator) outPath(tf *templateFile, combination map[string]interface{}) (
+	outDir, outPath string, warning error) {
+
+	fragmentsSubstituted, warning := g.substituteNames(tf.splitBaseDir, combination)
+	outPathnameBottom := strings.Join(fragmentsSubstituted, "")
+	outBottomDir := path.Dir(outPathnameBottom)
+	outDir = g.opts.OutTopDir + "/" + outBottomDir
+
+	outBaseName := path.Base(outPathnameBottom)
+	outPath = path.Clean(outDir + "/" + outBaseName)
+	outDir = path.Clean(outDir)
+	return
+}
+
+// writeJob writes the rendering of 'j' to its output path, unless either
+// some earlier job claimed the same path, or the file already holds the
+// same content.
+func (g *Generator) writeJob(j *job) error {
+	r, err := g.render(j)
+	if err != nil {
+		return err
+	}
+	j.result = Result{
+		TemplatePath:   j.path,
+		TemplateSHA256: j.sha256,
+		OutPath:        j.outPath,
+		Bindings:       j.bindings,
+		SHA256:         hex.EncodeToString(r.sum[:]),
+		Lines:          r.lines,
+		Copied:         !j.isTemplate,
+	}
+	if j.isDuplicate() {
+		return nil
+	}
+	outPath := j.outPath
+
+	// X  Leave any file already holding the expected content untouched, so
+	//    that its mtime does not trigger needless rebuilds downstream.
+	onDisk, err := ioutil.ReadFile(outPath)
+	if err == nil {
+		if bytes.Equal(onDisk, r.content) {
+			j.result.Unchanged = true
+			return nil
+		}
+		if !g.opts.Clobber {
+			return &PathCollisionError{
+				TemplatePath: j.path,
+				OutPath:      outPath,
+				Combination:  j.bindings,
+			}
+		}
+		// X  If already existing, allow truncation by os.Create(), but no other
+		//    operations.
+		_ = os.Chmod(outPath, 0600)
+	}
+
+	if err := os.MkdirAll(j.outDir, 0750); err != nil {
+		return err
+	}
+	// X  Turn off 'w' bits, as a reminder to later readers of the output that file
+	//    should not be edited.  Files copied through keep any 'x' bits.
+	outMode := os.FileMode(0440)
+	if !j.isTemplate {
+		outMode = j.mode &^ 0222
+	}
+	if err := ioutil.WriteFile(outPath, r.content, outMode); err != nil {
+		return fmt.Errorf("failed to create output file '%s': %w", outPath, err)
+	}
+	// X  WriteFile() applies 'perm' only when creating the file.
+	return os.Chmod(outPath, outMode)
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var lockstepKeys = []KvpArg{
+	{Key: "A", Values: []string{"1", "2"}},
+	{Key: "B", Values: []string{"x"}},
+	{Key: "C", Values: []string{"3", "4"}},
+	{Key: "D", Values: []string{"y", "z"}},
+	{Key: "E", Values: []string{"5", "6", "7"}},
+	{Key: "F", Values: []string{"w"}},
+}
+
+func TestDimensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockstep [][]string
+		want     [][]int
+	}{
+		{"none", nil, [][]int{{0}, {1}, {2}, {3}, {4}, {5}}},
+		{"pair", [][]string{{"A", "C"}}, [][]int{{0, 2}, {1}, {3}, {4}, {5}}},
+		{"placed at first Key", [][]string{{"D", "A"}}, [][]int{{0, 3}, {1}, {2}, {4}, {5}}},
+		{"triple", [][]string{{"A", "C", "D"}}, [][]int{{0, 2, 3}, {1}, {4}, {5}}},
+		{"two groups", [][]string{{"F", "B"}, {"C", "D"}}, [][]int{{0}, {1, 5}, {2, 3}, {4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dimensions(lockstepKeys, tt.lockstep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDimensionsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockstep [][]string
+		reason   string
+	}{
+		{"single Key", [][]string{{"A"}}, "group requires at least two Keys"},
+		{"unknown Key", [][]string{{"A", "X"}}, "unknown Key 'X'"},
+		{"Key in two groups", [][]string{{"A", "C"}, {"D", "A"}}, "Key 'A' in more than one group"},
+		{"Key repeated", [][]string{{"A", "A"}}, "Key 'A' in more than one group"},
+		{"unequal counts", [][]string{{"A", "E"}}, "Key 'E' has 3 values, but 'A' has 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dimensions(lockstepKeys, tt.lockstep)
+			var lockstepErr *LockstepError
+			if !errors.As(err, &lockstepErr) || lockstepErr.Reason != tt.reason {
+				t.Errorf("got error %v, want LockstepError: %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestLockstepCombinations(t *testing.T) {
+	g, err := New(Options{
+		TemplatePaths: []string{"out.txt"},
+		TemplateText:  "x\n",
+		KvpArgs: []KvpArg{
+			{Key: "N", Values: []string{"8", "16"}},
+			{Key: "S", Values: []string{"a", "b"}},
+			{Key: "T", Values: []string{"uint8", "uint16"}},
+		},
+		Lockstep:  [][]string{{"N", "T"}},
+		OutTopDir: t.TempDir(),
+		Logger:    quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"N": 8, "S": "a", "T": "uint8"},
+		{"N": 8, "S": "b", "T": "uint8"},
+		{"N": 16, "S": "a", "T": "uint16"},
+		{"N": 16, "S": "b", "T": "uint16"},
+	}
+	if got := g.combinations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	kvpArgs := []KvpArg{
+		{Key: "G", Values: []string{"8", "x"}},
+		{Key: "I", Type: "int", Values: []string{"0x10"}},
+		{Key: "S", Type: "string", Values: []string{"8"}},
+		{Key: "B", Type: "bool", Values: []string{"true", "false"}},
+	}
+	tests := []struct {
+		noTypeGuess bool
+		want        [][]interface{}
+	}{
+		{false, [][]interface{}{{8, "x"}, {16}, {"8"}, {true, false}}},
+		{true, [][]interface{}{{"8", "x"}, {16}, {"8"}, {true, false}}},
+	}
+	for _, tt := range tests {
+		got, err := typedValues(kvpArgs, tt.noTypeGuess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("noTypeGuess %v: got %v, want %v", tt.noTypeGuess, got, tt.want)
+		}
+	}
+
+	_, err := typedValues([]KvpArg{{Key: "U", Type: "uint", Values: []string{"1", "-1"}}}, false)
+	if err == nil || !strings.HasPrefix(err.Error(), "Key 'U': ") {
+		t.Errorf("got error %v, want one naming Key 'U'", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// partialFuncName names the function through which every call of a partial
+// is routed, so that its output may be line-checked.
+const partialFuncName = "gempPartial"
+
+// partialSpan locates the body of one {{define}} or {{block}}.
+type partialSpan struct {
+	path  string // of file defining it
+	lines int    // newline-terminated lines spanned by its body
+}
+
+// newTemplateSet returns an empty template set, ready to parse.
+func newTemplateSet() *template.Template {
+	funcs := Funcs()
+	funcs[partialFuncName] = func(string, interface{}) (string, error) {
+		panic("unbound " + partialFuncName)
+	}
+	return template.New("").Funcs(funcs).Option("missingkey=error")
+}
+
+// parseIncludes parses each file named by Options.Includes into the set of
+// templates from which that of each template file is cloned, each named by
+// its path, cleaned.  Returns the cleaned paths of the files parsed.
+func (g *Generator) parseIncludes() ([]string, error) {
+	g.base = newTemplateSet()
+	g.partials = make(map[string]partialSpan)
+	if len(g.opts.Includes) == 0 {
+		return nil, nil
+	}
+	walked, _, err := walkTemplatePaths(g.opts.Includes)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	seen := make(map[string]bool, len(walked))
+	for _, includePath := range walked {
+		// X  './inc/x' and 'inc/x' name the same file.
+		if includePath = filepath.Clean(includePath); seen[includePath] {
+			continue
+		}
+		seen[includePath] = true
+		paths = append(paths, includePath)
+
+		text, _, err := getTemplate(includePath)
+		if err != nil {
+			return nil, err
+		}
+		left, right, body, err := g.fileDelims(includePath, string(text))
+		if err != nil {
+			return nil, err
+		}
+		if g.opts.Dialect == DialectToken {
+			body = translateTokens(body, left, right)
+		}
+		if _, err := g.base.New(includePath).Delims(left, right).Parse(body); err != nil {
+			return nil, &TemplateParseError{
+				TemplatePath: includePath,
+				Line:         templateErrLine(err),
+				Err:          err,
+			}
+		}
+		g.markLines(g.base, includePath, body)
+		for name, span := range defineSpans(includePath, body, left, right) {
+			g.partials[name] = span
+		}
+	}
+	return paths, nil
+}
+
+// parseTemplateSet parses 'text' of template file 'templatePath', with
+// action delimiters 'left' and 'right', into a clone of the set of included
+// templates, returning the template of the file itself.
+func (g *Generator) parseTemplateSet(templatePath, text, left, right string) (
+	*template.Template, error) {
+
+	set, err := g.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	// X  Clone shares the parse trees of the included templates, which
+	//    routePartialCalls rewrites per set.
+	for _, t := range set.Templates() {
+		if t.Tree != nil {
+			t.Tree = t.Tree.Copy()
+		}
+	}
+	tmpl, err := set.New(templatePath).Delims(left, right).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	g.markLines(set, templatePath, text)
+
+	// X  Partials defined by this file supersede those of the includes.
+	spans := make(map[string]partialSpan, len(g.partials))
+	for name, span := range g.partials {
+		spans[name] = span
+	}
+	for name, span := range defineSpans(templatePath, text, left, right) {
+		spans[name] = span
+	}
+	for _, t := range set.Templates() {
+		if t.Tree != nil {
+			routePartialCalls(set, t.Tree, t.Tree.Root, spans)
+		}
+	}
+	set.Funcs(template.FuncMap{
+		partialFuncName: func(name string, data interface{}) (string, error) {
+			var out bytes.Buffer
+			if err := set.ExecuteTemplate(&out, name, data); err != nil {
+				return "", err
+			}
+			span := spans[name]
+			// X  Output of any length is allowed for by line directives, or
+			//    else caught by the check of the whole file.
+			if g.opts.LineMode == LineModeDirectives || g.opts.LineCheck != LineCheckError {
+				return out.String(), nil
+			}
+			if outLines := countLines(out.String()); outLines != span.lines {
+				return "", &LineCountError{
+					TemplatePath: span.path,
+					Partial:      name,
+					TemplLines:   span.lines,
+					OutLines:     outLines,
+				}
+			}
+			return out.String(), nil
+		},
+	})
+	return tmpl, nil
+}
+
+// markLines marks the lines of each template of 'set' parsed from
+// 'templatePath', so that lines of output may be traced to their origin.
+func (g *Generator) markLines(set *template.Template, templatePath, text string) {
+	for _, t := range set.Templates() {
+		if t.Tree != nil && t.Tree.ParseName == templatePath {
+			markLines(t.Tree.Root, templatePath, text)
+		}
+	}
+}
+
+// routePartialCalls resolves the name of each {{template "name" pipeline}}
+// below 'list' of 'tree' by partialName, then replaces each naming one of
+// 'spans' with {{gempPartial "name" (pipeline)}}.
+func routePartialCalls(set *template.Template, tree *parse.Tree, list *parse.ListNode,
+	spans map[string]partialSpan) {
+
+	if list == nil {
+		return
+	}
+	for i, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TemplateNode:
+			n.Name = partialName(set, tree.ParseName, n.Name)
+			if _, ok := spans[n.Name]; !ok {
+				continue
+			}
+			var data parse.Node = &parse.NilNode{NodeType: parse.NodeNil, Pos: n.Pos}
+			if n.Pipe != nil {
+				data = n.Pipe
+			}
+			list.Nodes[i] = &parse.ActionNode{
+				NodeType: parse.NodeAction,
+				Pos:      n.Pos,
+				Line:     n.Line,
+				Pipe: &parse.PipeNode{
+					NodeType: parse.NodePipe,
+					Pos:      n.Pos,
+					Line:     n.Line,
+					Cmds: []*parse.CommandNode{{
+						NodeType: parse.NodeCommand,
+						Pos:      n.Pos,
+						Args: []parse.Node{
+							parse.NewIdentifier(partialFuncName).SetTree(tree).SetPos(n.Pos),
+							&parse.StringNode{
+								NodeType: parse.NodeString,
+								Pos:      n.Pos,
+								Quoted:   strconv.Quote(n.Name),
+								Text:     n.Name,
+							},
+							data,
+						},
+					}},
+				},
+			}
+		case *parse.IfNode:
+			routePartialCalls(set, tree, n.List, spans)
+			routePartialCalls(set, tree, n.ElseList, spans)
+		case *parse.RangeNode:
+			routePartialCalls(set, tree, n.List, spans)
+			routePartialCalls(set, tree, n.ElseList, spans)
+		case *parse.WithNode:
+			routePartialCalls(set, tree, n.List, spans)
+			routePartialCalls(set, tree, n.ElseList, spans)
+		}
+	}
+}
+
+// partialName returns the name by which 'set' knows the template 'name'
+// invoked from file 'fromPath':  'name' itself if so defined, or else the
+// cleaned path of an included file, taking 'name' relative first to the
+// directory of 'fromPath', then to the working directory.
+func partialName(set *template.Template, fromPath, name string) string {
+	if set.Lookup(name) != nil {
+		return name
+	}
+	candidates := []string{filepath.Clean(name)}
+	if !filepath.IsAbs(name) {
+		candidates = append([]string{filepath.Join(filepath.Dir(fromPath), name)}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if set.Lookup(candidate) != nil {
+			return candidate
+		}
+	}
+	return name
+}
+
+// defineSpans finds the body of each {{define "name"}} and {{block "name"}}
+// of 'text', by a scan of its actions, set off by 'leftDelim' and
+// 'rightDelim', sufficient to match each with its {{end}}.
+func defineSpans(path, text, leftDelim, rightDelim string) map[string]partialSpan {
+	type open struct {
+		name      string // "" unless define or block
+		bodyStart int
+	}
+	spans := make(map[string]partialSpan)
+	var stack []open
+
+	for off := 0; ; {
+		start := strings.Index(text[off:], leftDelim)
+		if start < 0 {
+			return spans
+		}
+		start += off
+		inner := start + len(leftDelim)
+		var end int
+		action := strings.TrimLeft(strings.TrimPrefix(text[inner:], "-"), " \t\r\n")
+		if strings.HasPrefix(action, "/*") {
+			// X  A comment may contain the right delimiter.
+			close := strings.Index(text[inner:], "*/")
+			if close < 0 {
+				return spans
+			}
+			end = strings.Index(text[inner+close:], rightDelim)
+			if end < 0 {
+				return spans
+			}
+			end += inner + close
+		} else if end = strings.Index(text[inner:], rightDelim); end < 0 {
+			return spans
+		} else {
+			end += inner
+		}
+		off = end + len(rightDelim)
+
+		fields := strings.Fields(strings.Trim(text[inner:end], "- \t\r\n"))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "define", "block":
+			name := ""
+			if len(fields) > 1 {
+				name, _ = strconv.Unquote(fields[1])
+			}
+			stack = append(stack, open{name, off})
+		case "if", "range", "with":
+			stack = append(stack, open{})
+		case "end":
+			if len(stack) == 0 {
+				continue
+			}
+			o := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if o.name != "" {
+				spans[o.name] = partialSpan{
+					path:  path,
+					lines: countLines(text[o.bodyStart:start]),
+				}
+			}
+		}
+	}
+}
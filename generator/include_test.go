@@ -0,0 +1,75 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestIncludeAtLineOffsets(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"p.tmpl": "{{define \"two\"}}one {{.K}}\ntwo\n{{end}}{{define \"wrap\"}}{{template \"two\" .}}{{end}}",
+		"a.go":   "package a\n{{template \"two\" .}}var a int\n",
+		"b.go":   "package b\n\n\n{{template \"wrap\" .}}var b int\n",
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inc := filepath.Join(dir, "p.tmpl")
+	g, err := New(Options{
+		TemplatePaths: []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")},
+		Includes:      []string{inc},
+		KvpArgs:       []KvpArg{{Key: "K", Values: []string{"1"}}},
+		LineMode:      LineModeDirectives,
+		OutTopDir:     t.TempDir(),
+		Logger:        quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type origin struct {
+		file string
+		line int
+	}
+	tests := []struct {
+		file string
+		want []origin
+	}{
+		{"a.go", []origin{{"a.go", 1}, {"p.tmpl", 1}, {"p.tmpl", 2}, {"a.go", 2}}},
+		{"b.go", []origin{{"b.go", 1}, {"b.go", 2}, {"b.go", 3},
+			{"p.tmpl", 1}, {"p.tmpl", 2}, {"b.go", 4}}},
+	}
+	for i, tt := range tests {
+		tf := g.files[i]
+		var out bytes.Buffer
+		if err := tf.tmpl.Execute(&out, map[string]interface{}{"K": 1}); err != nil {
+			t.Fatal(err)
+		}
+		resolved, origins, _ := resolveLineMarkers(out.Bytes(), tf.path)
+		if len(origins) != len(tt.want) {
+			t.Fatalf("%s: got %d lines of output, want %d:\n%s",
+				tt.file, len(origins), len(tt.want), resolved)
+		}
+		for j, o := range origins {
+			if got := (origin{filepath.Base(o.path), o.line}); got != tt.want[j] {
+				t.Errorf("%s: output line %d: got origin %v, want %v", tt.file, j+1, got, tt.want[j])
+			}
+		}
+	}
+
+	// Each set rewrites calls of partials in its own copy of the included trees.
+	for _, name := range []string{"two", "wrap"} {
+		a, b := g.files[0].tmpl.Lookup(name), g.files[1].tmpl.Lookup(name)
+		base := g.base.Lookup(name)
+		if a.Tree == b.Tree || a.Tree == base.Tree || b.Tree == base.Tree {
+			t.Errorf("parse tree of partial '%s' shared among template sets", name)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// job renders one input file for one combination of values.  All fields
+	// but those of the final group are immutable once enumerated.
+	job struct {
+		index int
+		*templateFile
+		// K=V pairs, plus any Options.Data, plus synthetic pairs "thisDir"
+		// and BuiltinsKey
+		bindings        map[string]interface{}
+		outDir, outPath string
+		// Index of the first job of this run claiming 'outPath'
+		firstIndex int
+		// Combination rejected by Options.Where or Options.Exclude
+		skipped bool
+
+		// Written only by the worker rendering this job, then read by the
+		// collector once the job is done.
+		logs   []string
+		sum    [sha256.Size]byte
+		result Result
+	}
+
+	// rendering is the in-memory expansion of one job.
+	rendering struct {
+		content []byte
+		sum     [sha256.Size]byte
+		lines   int
+	}
+)
+
+// isDuplicate reports whether some earlier job claimed the same output path.
+func (j *job) isDuplicate() bool {
+	// X  Combinations differing only in Keys not used by this file are
+	//    harmless, as long as all yield identical content.
+	return j.firstIndex != j.index
+}
+
+// jobs enumerates one job for each selected combination of values, for each
+// input file in turn.
+func (g *Generator) jobs() []*job {
+	return g.enumerate(false)
+}
+
+// enumerate is jobs, optionally including also those of combinations
+// rejected by Options.Where or Options.Exclude, marked as 'skipped'.
+func (g *Generator) enumerate(withSkipped bool) (jobs []*job) {
+	combos := g.combinations()
+	selected := make([]bool, len(combos))
+	total := 0
+	for i, combination := range combos {
+		if selected[i] = g.selected(combination); selected[i] {
+			total++
+		}
+	}
+	firstIndex := make(map[string]int)
+	for _, tf := range g.files {
+		index := 0
+		for i, combination := range combos {
+			if !selected[i] && !withSkipped {
+				continue
+			}
+			j := &job{
+				index:        len(jobs),
+				templateFile: tf,
+				skipped:      !selected[i],
+			}
+			var warning error
+			j.outDir, j.outPath, warning = g.outPath(tf, combination)
+			// X  Files copied through commonly do not vary by combination.
+			if warning != nil && tf.isTemplate && !j.skipped {
+				j.logs = append(j.logs, warning.Error())
+			}
+
+			// Make these synthetic K=V pairs available to the template.
+			j.bindings = copyMap(combination)
+			for k, v := range g.opts.Data {
+				j.bindings[k] = v
+			}
+			j.bindings["thisDir"] = j.outDir
+			j.bindings[BuiltinsKey] = g.builtins(j, index, total)
+			if !j.skipped {
+				index++
+			}
+
+			if first, ok := firstIndex[j.outPath]; ok {
+				j.firstIndex = first
+			} else {
+				j.firstIndex = j.index
+				if !j.skipped {
+					firstIndex[j.outPath] = j.index
+				}
+			}
+			jobs = append(jobs, j)
+		}
+	}
+	return
+}
+
+// selected reports whether 'combination' satisfies Options.Where, and not
+// Options.Exclude.
+func (g *Generator) selected(combination map[string]interface{}) bool {
+	if g.where != nil && !g.where.eval(combination) {
+		return false
+	}
+	return g.exclude == nil || !g.exclude.eval(combination)
+}
+
+// errCancelled marks jobs not begun, owing to failure of an earlier job.
+var errCancelled = errors.New("cancelled")
+
+// runJobs calls 'work' for each of 'jobs' on a pool of Options.Jobs
+// goroutines, then 'collect' for each in order of enumeration, along with
+// logging of the job's messages.  The first error, in order of enumeration,
+// cancels any later jobs not yet begun, and is returned.
+func (g *Generator) runJobs(jobs []*job, work func(*job) error, collect func(*job) error) error {
+	nWorkers := g.opts.Jobs
+	if nWorkers <= 0 {
+		nWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	// Index of the earliest job known to have failed.
+	failed := int64(len(jobs))
+	fail := func(index int) {
+		for {
+			f := atomic.LoadInt64(&failed)
+			if int64(index) >= f || atomic.CompareAndSwapInt64(&failed, f, int64(index)) {
+				return
+			}
+		}
+	}
+	errs := make([]error, len(jobs))
+	done := make([]chan struct{}, len(jobs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	queue := make(chan *job)
+	go func() {
+		defer close(queue)
+		for _, j := range jobs {
+			if int64(j.index) > atomic.LoadInt64(&failed) {
+				return
+			}
+			queue <- j
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < nWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				if int64(j.index) > atomic.LoadInt64(&failed) {
+					errs[j.index] = errCancelled
+				} else if errs[j.index] = work(j); errs[j.index] != nil {
+					fail(j.index)
+				}
+				close(done[j.index])
+			}
+		}()
+	}
+	// X  Return only once workers have finished, lest a caller see files
+	//    written after reported failure.
+	defer wg.Wait()
+
+	for _, j := range jobs {
+		<-done[j.index]
+		for _, msg := range j.logs {
+			g.opts.Logger.Println(msg)
+		}
+		err := errs[j.index]
+		if err == nil && j.isDuplicate() && jobs[j.firstIndex].sum != j.sum {
+			err = &PathCollisionError{
+				TemplatePath: j.path,
+				OutPath:      j.outPath,
+				Combination:  j.bindings,
+				ThisRun:      true,
+			}
+		}
+		if err == nil {
+			err = collect(j)
+		}
+		if err != nil {
+			fail(j.index)
+			return err
+		}
+	}
+	return nil
+}
+
+// render expands the input file of 'j' for its combination into memory.
+func (g *Generator) render(j *job) (*rendering, error) {
+	// X  Expand into memory first, so that a failure leaves no partially
+	//    written file behind.
+	if g.opts.Verbose {
+		j.logs = append(j.logs, "Combination map:\n"+FormatMap(j.bindings))
+	}
+
+	var out bytes.Buffer
+	if !j.isTemplate {
+		out.WriteString(j.text)
+	} else if err := j.tmpl.Execute(&out, j.bindings); err != nil {
+		var partialErr *LineCountError
+		if errors.As(err, &partialErr) {
+			partialErr.OutPath = j.outPath
+			partialErr.Combination = j.bindings
+			return nil, partialErr
+		}
+		return nil, &TemplateExecError{
+			TemplatePath: j.path,
+			Line:         templateErrLine(err),
+			Combination:  j.bindings,
+			Err:          err,
+		}
+	}
+	directive := g.lineDirective(j.outPath)
+	var origins []lineOrigin
+	var marks []lineMark
+	if j.isTemplate {
+		var resolved []byte
+		resolved, origins, marks = resolveLineMarkers(out.Bytes(), j.path)
+		out.Reset()
+		out.Write(resolved)
+	}
+	if format := g.formatterFor(j.outPath); format != nil && j.isTemplate {
+		formatted, line, err := format(out.Bytes())
+		if err != nil {
+			templatePath := j.path
+			if 0 < line && line <= len(origins) {
+				templatePath, line = origins[line-1].path, origins[line-1].line
+			}
+			return nil, &FormatError{
+				TemplatePath: templatePath,
+				Line:         line,
+				OutPath:      j.outPath,
+				Combination:  j.bindings,
+				Err:          err,
+			}
+		}
+		if directive != nil {
+			origins = realignOrigins(out.Bytes(), formatted, origins)
+		}
+		out.Reset()
+		out.Write(formatted)
+	}
+	if directive != nil && j.isTemplate {
+		inserted := insertLineDirectives(out.Bytes(), j.path, origins, directive,
+			filepath.Ext(j.outPath) == ".go")
+		out.Reset()
+		out.Write(inserted)
+	}
+	j.sum = sha256.Sum256(out.Bytes())
+
+	outLines := countLines(out.String())
+	if outLines != j.templLines && directive == nil && g.opts.LineCheck != LineCheckOff {
+		err := &LineCountError{
+			TemplatePath: j.path,
+			OutPath:      j.outPath,
+			Combination:  j.bindings,
+			TemplLines:   j.templLines,
+			OutLines:     outLines,
+		}
+		if j.isTemplate {
+			err.Drift = findDrift(j.templateFile, marks, j.bindings)
+		}
+		if g.opts.LineCheck == LineCheckError {
+			return nil, err
+		}
+		j.logs = append(j.logs, "WARNING: "+err.Error())
+	}
+	return &rendering{
+		content: out.Bytes(),
+		sum:     j.sum,
+		lines:   outLines,
+	}, nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quietLogger discards warnings, e.g. of output paths expanding no Key.
+var quietLogger = log.New(ioutil.Discard, "", 0)
+
+func TestCollisionWritesNothing(t *testing.T) {
+	outTopDir := t.TempDir()
+	g, err := New(Options{
+		TemplatePaths: []string{"c.txt"},
+		TemplateText:  "K is {{.K}}\n",
+		KvpArgs:       []KvpArg{{Key: "K", Values: []string{"1", "2"}}},
+		OutTopDir:     outTopDir,
+		Jobs:          1,
+		Logger:        quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.ExpandTemplate()
+	var collisionErr *PathCollisionError
+	if !errors.As(err, &collisionErr) || !collisionErr.ThisRun {
+		t.Fatalf("got error %v, want PathCollisionError of this run", err)
+	}
+	entries, err := ioutil.ReadDir(outTopDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("found '%s', want nothing written", e.Name())
+	}
+}
+
+// newTestJobs returns 'n' jobs, each claiming its own output path.
+func newTestJobs(n int) []*job {
+	jobs := make([]*job, n)
+	for i := range jobs {
+		jobs[i] = &job{
+			index:        i,
+			templateFile: &templateFile{path: "t"},
+			outPath:      fmt.Sprintf("out%d", i),
+			firstIndex:   i,
+		}
+	}
+	return jobs
+}
+
+func TestRunJobsOrder(t *testing.T) {
+	for _, nWorkers := range []int{1, 3, 16} {
+		t.Run(fmt.Sprint(nWorkers), func(t *testing.T) {
+			var logs bytes.Buffer
+			g := &Generator{opts: Options{Jobs: nWorkers, Logger: log.New(&logs, "", 0)}}
+			jobs := newTestJobs(10)
+			var collected []int
+			err := g.runJobs(jobs,
+				func(j *job) error {
+					// Later jobs finish first.
+					time.Sleep(time.Duration(len(jobs)-j.index) * time.Millisecond)
+					j.logs = append(j.logs, fmt.Sprint("job ", j.index))
+					return nil
+				},
+				func(j *job) error {
+					collected = append(collected, j.index)
+					return nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []int
+			var wantLogs []string
+			for i := range jobs {
+				want = append(want, i)
+				wantLogs = append(wantLogs, fmt.Sprint("job ", i))
+			}
+			if !reflect.DeepEqual(collected, want) {
+				t.Errorf("got collected %v, want %v", collected, want)
+			}
+			if got, want := logs.String(), strings.Join(wantLogs, "\n")+"\n"; got != want {
+				t.Errorf("got logs:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRunJobsFirstError(t *testing.T) {
+	errEarly, errLate := errors.New("early"), errors.New("late")
+	tests := []struct {
+		name      string
+		nWorkers  int
+		failures  map[int]error // of work, by job index
+		delays    map[int]time.Duration
+		collects  map[int]error // of collect, by job index
+		want      error
+		collected int
+	}{
+		{"none", 4, nil, nil, nil, nil, 8},
+		{"one", 4, map[int]error{3: errEarly}, nil, nil, errEarly, 3},
+		{"serial", 1, map[int]error{2: errEarly, 5: errLate}, nil, nil, errEarly, 2},
+		// The later job fails first in time, but the earlier is reported.
+		{"out of order", 4, map[int]error{1: errEarly, 2: errLate},
+			map[int]time.Duration{1: 20 * time.Millisecond}, nil, errEarly, 1},
+		{"in collect", 4, map[int]error{7: errLate}, nil, map[int]error{6: errEarly}, errEarly, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Generator{opts: Options{Jobs: tt.nWorkers, Logger: quietLogger}}
+			collected := 0
+			err := g.runJobs(newTestJobs(8),
+				func(j *job) error {
+					time.Sleep(tt.delays[j.index])
+					return tt.failures[j.index]
+				},
+				func(j *job) error {
+					if err := tt.collects[j.index]; err != nil {
+						return err
+					}
+					collected++
+					return nil
+				})
+			if err != tt.want {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+			if collected != tt.collected {
+				t.Errorf("got %d jobs collected, want %d", collected, tt.collected)
+			}
+		})
+	}
+}
+
+func TestRunJobsCollision(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  []string // of jobs all claiming one output path
+		collision int      // index of job colliding, or -1
+	}{
+		{"agree", []string{"a", "a", "a"}, -1},
+		{"second differs", []string{"a", "b", "a"}, 1},
+		{"third differs", []string{"a", "a", "b"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Generator{opts: Options{Jobs: 2, Logger: quietLogger}}
+			jobs := newTestJobs(len(tt.contents))
+			for _, j := range jobs {
+				j.outPath, j.firstIndex = "out", 0
+			}
+			var collected []int
+			err := g.runJobs(jobs,
+				func(j *job) error {
+					j.sum = sha256.Sum256([]byte(tt.contents[j.index]))
+					return nil
+				},
+				func(j *job) error {
+					collected = append(collected, j.index)
+					return nil
+				})
+			if tt.collision < 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var collisionErr *PathCollisionError
+			if !errors.As(err, &collisionErr) || !collisionErr.ThisRun {
+				t.Fatalf("got error %v, want PathCollisionError of this run", err)
+			}
+			if len(collected) != tt.collision {
+				t.Errorf("got %d jobs collected before the collision, want %d", len(collected), tt.collision)
+			}
+		})
+	}
+}
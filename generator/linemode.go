@@ -0,0 +1,273 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/dmullis/gemp/internal/diff"
+)
+
+// Line modes, selected by Options.LineMode.
+const (
+	// Each output file must span exactly as many lines as its template.
+	LineModeStrict = "strict"
+
+	// Output may span more or fewer lines than its template.  Wherever
+	// their lines part company, a line directive is inserted, naming the
+	// template file and line from which the following output line was
+	// expanded, so that compiler diagnostics and stack traces still point
+	// into the template.  Output of an extension for which no form of
+	// directive is known is held to LineModeStrict.
+	LineModeDirectives = "directives"
+)
+
+// LineModes lists the valid values of Options.LineMode.
+var LineModes = []string{LineModeStrict, LineModeDirectives}
+
+// lineDirectives gives the form of line directive of each extension of
+// output file.
+var lineDirectives = map[string]func(path string, line int) string{
+	".go":  goLineDirective,
+	".c":   cLineDirective,
+	".h":   cLineDirective,
+	".cc":  cLineDirective,
+	".cpp": cLineDirective,
+	".cxx": cLineDirective,
+	".hh":  cLineDirective,
+	".hpp": cLineDirective,
+	".hxx": cLineDirective,
+	".m":   cLineDirective,
+}
+
+func goLineDirective(path string, line int) string {
+	return fmt.Sprintf("//line %s:%d", path, line)
+}
+
+func cLineDirective(path string, line int) string {
+	return fmt.Sprintf("#line %d %s", line, strconv.Quote(path))
+}
+
+// lineMarker sets off each marker inserted into template text by markLines.
+// X  Template files hold no NUL, so neither does the text of their actions.
+const lineMarker = "\x00"
+
+// lineOrigin is the template file and line from which one line of output
+// was expanded.
+type lineOrigin struct {
+	path string
+	line int
+}
+
+// markLines inserts after each newline of each text node below 'list' a
+// marker naming the line of template 'path' begun there, 'text' being that
+// parsed.  A marker naming its line also begins each body of an action,
+// and follows each if, range, with or template call, since output may
+// return there from a later line, as does each iteration of a range, or from
+// another file, or skip ahead.
+func markLines(list *parse.ListNode, path, text string) {
+	if list == nil {
+		return
+	}
+	lineAt := func(pos parse.Pos) int {
+		return strings.Count(text[:pos], "\n") + 1
+	}
+	marker := func(line int) string {
+		return lineMarker + strconv.Itoa(line) + " " + path + lineMarker
+	}
+	// X  A {{define}} leading the file leaves its first node further on.
+	start := list.Pos
+	if len(list.Nodes) > 0 {
+		start = list.Nodes[0].Position()
+	}
+	nodes := []parse.Node{&parse.TextNode{
+		NodeType: parse.NodeText,
+		Pos:      start,
+		Text:     []byte(marker(lineAt(start))),
+	}}
+	for i, node := range list.Nodes {
+		if i > 0 {
+			switch list.Nodes[i-1].(type) {
+			case *parse.IfNode, *parse.RangeNode, *parse.WithNode, *parse.TemplateNode:
+				nodes = append(nodes, &parse.TextNode{
+					NodeType: parse.NodeText,
+					Pos:      node.Position(),
+					Text:     []byte(marker(lineAt(node.Position()))),
+				})
+			}
+		}
+		switch n := node.(type) {
+		case *parse.TextNode:
+			line := lineAt(n.Pos)
+			var marked []byte
+			for _, b := range n.Text {
+				marked = append(marked, b)
+				if b == '\n' {
+					line++
+					marked = append(marked, marker(line)...)
+				}
+			}
+			n.Text = marked
+		case *parse.IfNode:
+			markLines(n.List, path, text)
+			markLines(n.ElseList, path, text)
+		case *parse.RangeNode:
+			markLines(n.List, path, text)
+			markLines(n.ElseList, path, text)
+		case *parse.WithNode:
+			markLines(n.List, path, text)
+			markLines(n.ElseList, path, text)
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+// lineMark is one marker found in output.
+type lineMark struct {
+	outLine int // 1-based
+	origin  lineOrigin
+}
+
+// resolveLineMarkers removes the markers of 'out', expanded from template
+// 'templatePath', returning also the origin of each line of output, and
+// the markers found.
+func resolveLineMarkers(out []byte, templatePath string) ([]byte, []lineOrigin, []lineMark) {
+	var resolved bytes.Buffer
+	var origins []lineOrigin
+	var marks []lineMark
+	cur := lineOrigin{templatePath, 1}
+	lines := bytes.SplitAfter(out, []byte("\n"))
+	for i, line := range lines {
+		// X  Of markers heading a line, the last names its origin;  those
+		//    within a line are dropped.
+		for rest := line; bytes.HasPrefix(rest, []byte(lineMarker)); {
+			end := bytes.Index(rest[1:], []byte(lineMarker))
+			if end < 0 {
+				break
+			}
+			fields := strings.SplitN(string(rest[1:1+end]), " ", 2)
+			if n, err := strconv.Atoi(fields[0]); err == nil && len(fields) == 2 {
+				cur = lineOrigin{fields[1], n}
+				marks = append(marks, lineMark{i + 1, cur})
+			}
+			rest = rest[1+end+1:]
+		}
+		line = stripLineMarkers(line)
+		if len(line) == 0 && i == len(lines)-1 {
+			break
+		}
+		resolved.Write(line)
+		origins = append(origins, cur)
+		cur.line++
+	}
+	return resolved.Bytes(), origins, marks
+}
+
+// realignOrigins returns the origins of the lines of 'formatted', given
+// those of 'unformatted', matching lines whose text differs only in white
+// space.  A line inserted or rewritten by formatting is taken as following
+// the line before it.
+func realignOrigins(unformatted, formatted []byte, origins []lineOrigin) []lineOrigin {
+	normalize := func(text []byte) []string {
+		lines := strings.SplitAfter(string(text), "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for i, line := range lines {
+			lines[i] = strings.Join(strings.Fields(line), "")
+		}
+		return lines
+	}
+	matches := diff.Align(normalize(unformatted), normalize(formatted))
+	realigned := make([]lineOrigin, len(matches))
+	for i, match := range matches {
+		switch {
+		case match >= 0 && match < len(origins):
+			realigned[i] = origins[match]
+		case i > 0:
+			realigned[i] = lineOrigin{realigned[i-1].path, realigned[i-1].line + 1}
+		default:
+			realigned[i] = lineOrigin{origins[0].path, 1}
+		}
+	}
+	return realigned
+}
+
+// insertLineDirectives inserts into 'out', expanded from template
+// 'templatePath', a line directive formatted by 'directive' wherever the
+// origin of a non-empty line departs from that implied by the line before.  If
+// 'goComments', a directive is kept apart by an empty line from any
+// adjacent '//' comment, lest gofmt take it as part of a doc comment, and
+// move it.
+func insertLineDirectives(out []byte, templatePath string, origins []lineOrigin,
+	directive func(string, int) string, goComments bool) []byte {
+
+	isComment := func(line string) bool {
+		return goComments && strings.HasPrefix(strings.TrimSpace(line), "//")
+	}
+	var inserted strings.Builder
+	// X  Until the first directive, line N of output is taken by compilers
+	//    as line N, as of the template.
+	cur := lineOrigin{templatePath, 1}
+	prev := ""
+	for i, line := range strings.SplitAfter(string(out), "\n") {
+		if i >= len(origins) {
+			inserted.WriteString(line)
+			break
+		}
+		// X  Empty lines need no directive, and one before them would keep
+		//    gofmt from separating declarations by the usual empty line.
+		if origin := origins[i]; origin != cur && strings.TrimSpace(line) != "" {
+			if isComment(prev) {
+				inserted.WriteString("\n")
+			}
+			if isComment(line) && origin.line > 1 {
+				inserted.WriteString(directive(origin.path, origin.line-1) + "\n\n")
+			} else {
+				inserted.WriteString(directive(origin.path, origin.line) + "\n")
+			}
+			cur = origin
+		}
+		inserted.WriteString(line)
+		prev = line
+		cur.line++
+	}
+	return []byte(inserted.String())
+}
+
+func stripLineMarkers(line []byte) []byte {
+	for {
+		start := bytes.Index(line, []byte(lineMarker))
+		if start < 0 {
+			return line
+		}
+		end := bytes.Index(line[start+1:], []byte(lineMarker))
+		if end < 0 {
+			return line
+		}
+		line = append(line[:start:start], line[start+1+end+1:]...)
+	}
+}
+
+// lineDirective returns the form of line directive of output file
+// 'outPath', naming template files relative to its directory, or nil if
+// none is known or wanted.
+func (g *Generator) lineDirective(outPath string) func(string, int) string {
+	directive, ok := lineDirectives[filepath.Ext(outPath)]
+	if g.opts.LineMode != LineModeDirectives || !ok {
+		return nil
+	}
+	outDir := filepath.Dir(outPath)
+	return func(path string, line int) string {
+		if rel, err := filepath.Rel(outDir, path); err == nil {
+			path = rel
+		}
+		return directive(filepath.ToSlash(path), line)
+	}
+}
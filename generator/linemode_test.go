@@ -0,0 +1,136 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// rangeTemplate holds a range whose body spans template lines 4 and 5.
+const rangeTemplate = `package main
+
+func main() {
+	{{range .L}}_ = a[{{.}}]
+	_ = b[{{.}}]
+{{end}}}
+`
+
+func newRangeGenerator(t *testing.T, lineMode string) *Generator {
+	t.Helper()
+	g, err := New(Options{
+		TemplatePaths: []string{"main.go"},
+		TemplateText:  rangeTemplate,
+		Data:          map[string]interface{}{"L": []int{0, 1, 2}},
+		LineMode:      lineMode,
+		OutTopDir:     t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestRangeBodyOrigins(t *testing.T) {
+	g := newRangeGenerator(t, LineModeDirectives)
+	var out bytes.Buffer
+	if err := g.files[0].tmpl.Execute(&out, map[string]interface{}{"L": []int{0, 1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	resolved, origins, _ := resolveLineMarkers(out.Bytes(), "main.go")
+	want := []int{1, 2, 3, 4, 5, 4, 5, 4, 5, 6}
+	if len(origins) != len(want) {
+		t.Fatalf("got %d lines of output, want %d:\n%s", len(origins), len(want), resolved)
+	}
+	for i, origin := range origins {
+		if origin.path != "main.go" || origin.line != want[i] {
+			t.Errorf("output line %d: got origin %s:%d, want main.go:%d",
+				i+1, origin.path, origin.line, want[i])
+		}
+	}
+}
+
+func TestRangeBodyDirectives(t *testing.T) {
+	g := newRangeGenerator(t, LineModeDirectives)
+	results, err := g.ExpandTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(results[0].OutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package main
+
+func main() {
+	_ = a[0]
+	_ = b[0]
+//line main.go:4
+_ = a[1]
+	_ = b[1]
+//line main.go:4
+_ = a[2]
+	_ = b[2]
+}
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRangeBodyDrift(t *testing.T) {
+	g := newRangeGenerator(t, LineModeStrict)
+	_, err := g.ExpandTemplate()
+	var lineErr *LineCountError
+	if !errors.As(err, &lineErr) {
+		t.Fatalf("got error %v, want LineCountError", err)
+	}
+	if lineErr.Drift == nil {
+		t.Fatal("no drift found")
+	}
+	if lineErr.Drift.Repeated != 4 || lineErr.Drift.Line != 4 || lineErr.Drift.Action != "{{range .L}}" {
+		t.Errorf("got drift %+v, want template line 4 repeated by '{{range .L}}'", *lineErr.Drift)
+	}
+}
+
+// partialTemplate calls at line 4 a partial spanning two lines, defined
+// ahead of its first output line.
+const partialTemplate = `{{define "p"}}a
+b
+{{end}}package main
+{{template "p"}}var x int
+`
+
+func TestPartialReturnDirective(t *testing.T) {
+	g, err := New(Options{
+		TemplatePaths: []string{"main.go"},
+		TemplateText:  partialTemplate,
+		LineMode:      LineModeDirectives,
+		OutTopDir:     t.TempDir(),
+		Logger:        quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := g.ExpandTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(results[0].OutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `//line main.go:3
+package main
+//line main.go:1
+a
+b
+//line main.go:4
+var x int
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// DefaultManifestName is the conventional value of Options.ManifestName.
+const DefaultManifestName = ".gemp-manifest.json"
+
+type (
+	// Manifest records every output file of one run of ExpandTemplate, so
+	// that later tooling need not reverse-engineer output file names.
+	Manifest struct {
+		Entries []ManifestEntry `json:"entries"`
+	}
+
+	// ManifestEntry records one output file, and what it was generated from.
+	ManifestEntry struct {
+		TemplatePath   string                 `json:"templatePath"`
+		TemplateSHA256 string                 `json:"templateSHA256"`
+		Combination    map[string]interface{} `json:"combination"`
+		// relative to the directory holding the manifest, i.e. Options.OutTopDir
+		OutPath string `json:"outPath"`
+		SHA256  string `json:"sha256"`
+		Lines   int    `json:"lines"`
+	}
+)
+
+// ManifestPath returns the pathname of the manifest, if any, below OutTopDir.
+func (g *Generator) ManifestPath() string {
+	if g.opts.ManifestName == "" {
+		return ""
+	}
+	return path.Join(g.opts.OutTopDir, g.opts.ManifestName)
+}
+
+func (g *Generator) writeManifest(results []Result) error {
+	m := Manifest{Entries: make([]ManifestEntry, 0, len(results))}
+	for _, r := range results {
+		rel, err := filepath.Rel(g.opts.OutTopDir, r.OutPath)
+		if err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, ManifestEntry{
+			TemplatePath:   r.TemplatePath,
+			TemplateSHA256: r.TemplateSHA256,
+			Combination:    g.combination(r.Bindings),
+			OutPath:        filepath.ToSlash(rel),
+			SHA256:         r.SHA256,
+			Lines:          r.Lines,
+		})
+	}
+	text, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(g.opts.OutTopDir, 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(g.ManifestPath(), append(text, '\n'), 0640)
+}
+
+// combination omits from 'bindings' any synthetic K=V pairs, e.g. "thisDir".
+func (g *Generator) combination(bindings map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(g.opts.KvpArgs))
+	for _, kvp := range g.opts.KvpArgs {
+		if v, ok := bindings[kvp.Key]; ok {
+			c[kvp.Key] = v
+		}
+	}
+	return c
+}
+
+// ReadManifest reads a manifest written by an earlier ExpandTemplate.
+func ReadManifest(manifestPath string) (*Manifest, error) {
+	text, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(text, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	const text = "K is {{.K}}\nS is {{.S}}\n"
+	outTopDir := t.TempDir()
+	g, err := New(Options{
+		TemplatePaths:  []string{"out+K.txt"},
+		InKeySeparator: "+",
+		TemplateText:   text,
+		KvpArgs: []KvpArg{
+			{Key: "K", Values: []string{"1", "2", "3"}},
+			{Key: "S", Values: []string{"a"}},
+		},
+		Where:        "K != 2",
+		OutTopDir:    outTopDir,
+		ManifestName: DefaultManifestName,
+		Logger:       quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.ManifestPath(), filepath.Join(outTopDir, DefaultManifestName); got != want {
+		t.Errorf("got manifest path %s, want %s", got, want)
+	}
+	if _, err := g.ExpandTemplate(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(g.ManifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// X  Numbers read back from JSON are float64.
+	want := []ManifestEntry{
+		{
+			TemplatePath:   "out+K.txt",
+			TemplateSHA256: hexSum([]byte(text)),
+			Combination:    map[string]interface{}{"K": 1.0, "S": "a"},
+			OutPath:        "out-1.txt",
+			SHA256:         hexSum([]byte("K is 1\nS is a\n")),
+			Lines:          2,
+		},
+		{
+			TemplatePath:   "out+K.txt",
+			TemplateSHA256: hexSum([]byte(text)),
+			Combination:    map[string]interface{}{"K": 3.0, "S": "a"},
+			OutPath:        "out-3.txt",
+			SHA256:         hexSum([]byte("K is 3\nS is a\n")),
+			Lines:          2,
+		},
+	}
+	if !reflect.DeepEqual(m.Entries, want) {
+		t.Errorf("got entries %+v, want %+v", m.Entries, want)
+	}
+}
+
+func TestManifestOptional(t *testing.T) {
+	g, err := New(Options{
+		TemplatePaths: []string{"out.txt"},
+		TemplateText:  "x\n",
+		OutTopDir:     t.TempDir(),
+		Logger:        quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.ManifestPath(); got != "" {
+		t.Errorf("got manifest path %s, want none", got)
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "malformed.json")
+	if err := ioutil.WriteFile(malformed, []byte(`{"entries": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, manifestPath := range []string{filepath.Join(dir, "none.json"), malformed} {
+		if _, err := ReadManifest(manifestPath); err == nil {
+			t.Errorf("%s: no error", manifestPath)
+		}
+	}
+}
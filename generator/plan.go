@@ -0,0 +1,71 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+// PlanEntry describes one output file ExpandTemplate would write, for one
+// combination of values and one input file.
+type PlanEntry struct {
+	TemplatePath string                 `json:"templatePath"`
+	Combination  map[string]interface{} `json:"combination"`
+	OutPath      string                 `json:"outPath"`
+	Copied       bool                   `json:"copied,omitempty"`
+	Skipped      bool                   `json:"skipped,omitempty"` // rejected by Where or Exclude
+
+	// Duplicate marks an entry whose OutPath was claimed by an earlier one
+	// not Skipped.  ExpandTemplate writes such a path only once.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// Plan enumerates the combinations and output paths of ExpandTemplate,
+// without creating any directory or file.  Entries of combinations filtered
+// out are included, marked Skipped.  Templates are executed only where
+// combinations share an output path, returning a *PathCollisionError,
+// as would ExpandTemplate, unless all yield the same content.
+func (g *Generator) Plan() ([]PlanEntry, error) {
+	entries := g.plan()
+	if err := g.checkCollisions(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// plan is Plan, without the check of collisions.
+func (g *Generator) plan() []PlanEntry {
+	var entries []PlanEntry
+	for _, j := range g.enumerate(true) {
+		for _, msg := range j.logs {
+			g.opts.Logger.Println(msg)
+		}
+		entries = append(entries, PlanEntry{
+			TemplatePath: j.path,
+			Combination:  g.combination(j.bindings),
+			OutPath:      j.outPath,
+			Copied:       !j.isTemplate,
+			Skipped:      j.skipped,
+			Duplicate:    !j.skipped && j.isDuplicate(),
+		})
+	}
+	return entries
+}
+
+// checkCollisions renders in memory each job whose output path is claimed
+// also by another, so that runJobs may compare their content.
+func (g *Generator) checkCollisions() error {
+	jobs := g.jobs()
+	claims := make(map[string]int, len(jobs))
+	for _, j := range jobs {
+		claims[j.outPath]++
+	}
+	// X  Messages are left to the caller's own enumeration of jobs.
+	return g.runJobs(jobs,
+		func(j *job) error {
+			j.logs = nil
+			if claims[j.outPath] < 2 {
+				return nil
+			}
+			_, err := g.render(j)
+			j.logs = nil
+			return err
+		},
+		func(*job) error { return nil })
+}
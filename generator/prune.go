@@ -0,0 +1,93 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// StaleOutputs compares the current Plan against the manifest of an earlier
+// run, returning the pathnames of files that manifest records, which the
+// current Plan no longer generates.  Files absent, or modified since
+// generation, are omitted.  Absence of the manifest implies nothing is stale.
+func (g *Generator) StaleOutputs() ([]string, error) {
+	if g.opts.ManifestName == "" {
+		return nil, fmt.Errorf("pruning requires a manifest name")
+	}
+	m, err := ReadManifest(g.ManifestPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := g.plan()
+	current := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.Skipped {
+			continue
+		}
+		current[path.Clean(e.OutPath)] = true
+	}
+
+	var stale []string
+	for _, me := range m.Entries {
+		// X  Never reach outside of OutTopDir, whatever the manifest says.
+		rel := path.Clean(me.OutPath)
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			g.opts.Logger.Printf("WARNING: ignoring manifest entry outside of '%s': '%s'",
+				g.opts.OutTopDir, me.OutPath)
+			continue
+		}
+		outPath := path.Join(g.opts.OutTopDir, rel)
+		if current[outPath] {
+			continue
+		}
+		content, err := ioutil.ReadFile(outPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if hexSum(content) != me.SHA256 {
+			g.opts.Logger.Printf("WARNING: not pruning '%s', modified since generation",
+				outPath)
+			continue
+		}
+		stale = append(stale, outPath)
+	}
+	return stale, nil
+}
+
+// Prune removes the files returned by StaleOutputs, and any directories
+// below OutTopDir thereby left empty.  It returns the pathnames removed.
+func (g *Generator) Prune() (removed []string, err error) {
+	stale, err := g.StaleOutputs()
+	if err != nil {
+		return nil, err
+	}
+	topDir := filepath.Clean(g.opts.OutTopDir)
+	for _, outPath := range stale {
+		if err := os.Remove(outPath); err != nil {
+			return removed, err
+		}
+		removed = append(removed, outPath)
+		if g.opts.Verbose {
+			g.opts.Logger.Printf("Pruned '%s'", outPath)
+		}
+
+		// X  os.Remove() refuses any directory not empty.
+		for dir := filepath.Dir(outPath); dir != topDir && dir != "."; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+			removed = append(removed, dir)
+		}
+	}
+	return removed, nil
+}
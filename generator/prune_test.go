@@ -0,0 +1,123 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newPruneGenerator expands 'd+K/out.txt' for each of 'values' of K.
+func newPruneGenerator(t *testing.T, outTopDir string, values ...string) *Generator {
+	t.Helper()
+	g, err := New(Options{
+		TemplatePaths:  []string{"d+K/out.txt"},
+		TemplateText:   "K is {{.K}}\n",
+		InKeySeparator: "+",
+		KvpArgs:        []KvpArg{{Key: "K", Values: values}},
+		OutTopDir:      outTopDir,
+		ManifestName:   DefaultManifestName,
+		Logger:         quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestPrune(t *testing.T) {
+	outTopDir := t.TempDir()
+	if _, err := newPruneGenerator(t, outTopDir, "1", "2", "3", "4").ExpandTemplate(); err != nil {
+		t.Fatal(err)
+	}
+	// d-3 is modified since generation, d-4 already gone.
+	modified := filepath.Join(outTopDir, "d-3", "out.txt")
+	if err := os.Chmod(modified, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(modified, []byte("edited\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(outTopDir, "d-4", "out.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newPruneGenerator(t, outTopDir, "1")
+	stale, err := g.StaleOutputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStale := []string{filepath.Join(outTopDir, "d-2", "out.txt")}
+	if !reflect.DeepEqual(stale, wantStale) {
+		t.Errorf("got stale %v, want %v", stale, wantStale)
+	}
+
+	removed, err := g.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRemoved := append(wantStale, filepath.Join(outTopDir, "d-2"))
+	if !reflect.DeepEqual(removed, wantRemoved) {
+		t.Errorf("got removed %v, want %v", removed, wantRemoved)
+	}
+	tests := []struct {
+		path   string
+		exists bool
+	}{
+		{"d-1/out.txt", true},
+		{"d-2", false},
+		{"d-3/out.txt", true},
+		{"d-4", true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(outTopDir, tt.path))
+		if exists := err == nil; exists != tt.exists {
+			t.Errorf("%s: got exists %v, want %v", tt.path, exists, tt.exists)
+		}
+	}
+}
+
+func TestStaleOutputsOutsideTopDir(t *testing.T) {
+	parent := t.TempDir()
+	outTopDir := filepath.Join(parent, "top")
+	if err := os.Mkdir(outTopDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(parent, "outside.txt")
+	if err := ioutil.WriteFile(outside, []byte("x\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"entries": [{"outPath": "../outside.txt",
+		"sha256": "` + hexSum([]byte("x\n")) + `"}]}`
+	if err := ioutil.WriteFile(filepath.Join(outTopDir, DefaultManifestName),
+		[]byte(manifest), 0640); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := newPruneGenerator(t, outTopDir, "1").StaleOutputs()
+	if err != nil || len(stale) != 0 {
+		t.Errorf("got %v, %v, want nothing stale", stale, err)
+	}
+}
+
+func TestStaleOutputsNoManifest(t *testing.T) {
+	stale, err := newPruneGenerator(t, t.TempDir(), "1").StaleOutputs()
+	if err != nil || stale != nil {
+		t.Errorf("got %v, %v, want nil, nil", stale, err)
+	}
+
+	g, err := New(Options{
+		TemplatePaths: []string{"out.txt"},
+		TemplateText:  "x\n",
+		OutTopDir:     t.TempDir(),
+		Logger:        quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.StaleOutputs(); err == nil {
+		t.Error("no error pruning without a manifest name")
+	}
+}
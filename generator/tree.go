@@ -0,0 +1,170 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName names a file excluding paths from any directory walk,
+// in a subset of the syntax of '.gitignore':
+//   - Blank lines, and lines beginning with '#', are ignored.
+//   - A trailing '/' matches only directories.
+//   - A pattern containing a '/' is matched, per path.Match, against the path
+//     relative to the directory holding the IgnoreFileName file; any other
+//     pattern is matched against the base name, at any depth.
+const IgnoreFileName = ".gempignore"
+
+// CopyFileName names a file, in the syntax of IgnoreFileName, matching
+// paths found by any directory walk that are copied through unchanged,
+// though still to an expanded pathname, rather than parsed as templates.
+// A matched directory is copied whole.
+const CopyFileName = ".gempcopy"
+
+type pathPattern struct {
+	dir      string // directory of the '.gempignore' or '.gempcopy' file
+	pattern  string
+	anchored bool
+	dirOnly  bool
+}
+
+// walkTemplatePaths expands glob patterns among 'templatePaths', and walks
+// any directories found, returning the files to be expanded, and the set of
+// those to be copied through.  Files found by walking a directory are
+// returned in lexical order.
+func walkTemplatePaths(templatePaths []string) (files []string, copied map[string]bool, err error) {
+	if len(templatePaths) == 0 {
+		return nil, nil, fmt.Errorf("no template paths given")
+	}
+	copied = make(map[string]bool)
+	for _, templatePath := range templatePaths {
+		matches := []string{templatePath}
+		if strings.ContainsAny(templatePath, "*?[") {
+			if matches, err = filepath.Glob(templatePath); err != nil {
+				return nil, nil, fmt.Errorf("bad glob pattern '%s': %w", templatePath, err)
+			}
+			if len(matches) == 0 {
+				return nil, nil, fmt.Errorf("no match for glob pattern '%s'", templatePath)
+			}
+		}
+		for _, match := range matches {
+			stat, err := os.Stat(match)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !stat.IsDir() {
+				files = append(files, match)
+				continue
+			}
+			walked, err := walkDir(match, copied)
+			if err != nil {
+				return nil, nil, err
+			}
+			files = append(files, walked...)
+		}
+	}
+	return
+}
+
+// walkDir returns the files below 'root' not ignored, adding to 'copied'
+// those to be copied through.
+func walkDir(root string, copied map[string]bool) (files []string, err error) {
+	var ignores, copies []pathPattern
+	copiedDirs := make(map[string]bool)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && isMatched(ignores, p, true) {
+				return filepath.SkipDir
+			}
+			if p != root && (copiedDirs[filepath.Dir(p)] || isMatched(copies, p, true)) {
+				copiedDirs[p] = true
+			}
+			// X  WalkDir() visits each directory before any of its entries,
+			//    so the directory's own '.gempignore' applies to all of them.
+			more, err := readPatternFile(p, IgnoreFileName)
+			if err != nil {
+				return err
+			}
+			ignores = append(ignores, more...)
+			if more, err = readPatternFile(p, CopyFileName); err != nil {
+				return err
+			}
+			copies = append(copies, more...)
+			return nil
+		}
+		if d.Name() == IgnoreFileName || d.Name() == CopyFileName || isMatched(ignores, p, false) {
+			return nil
+		}
+		if copiedDirs[filepath.Dir(p)] || isMatched(copies, p, false) {
+			copied[p] = true
+		}
+		files = append(files, p)
+		return nil
+	})
+	return
+}
+
+// readPatternFile reads the patterns of file 'name' of 'dir', if any.
+func readPatternFile(dir, name string) (patterns []pathPattern, err error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		pp := pathPattern{dir: dir}
+		if strings.HasSuffix(line, "/") {
+			pp.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			pp.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("%s: bad pattern '%s': %w",
+				filepath.Join(dir, name), line, err)
+		}
+		pp.pattern = line
+		patterns = append(patterns, pp)
+	}
+	return patterns, scanner.Err()
+}
+
+func isMatched(patterns []pathPattern, p string, isDir bool) bool {
+	for _, pp := range patterns {
+		if pp.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(pp.dir, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue // X  pattern from a sibling subtree
+		}
+		rel = filepath.ToSlash(rel)
+		subject := path.Base(rel)
+		if pp.anchored {
+			subject = rel
+		}
+		if matched, _ := path.Match(pp.pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkCopiesOnlyByRule(t *testing.T) {
+	inDir := t.TempDir()
+	files := map[string]string{
+		"plain.txt":     "no action here\n",
+		"tmpl.txt":      "K is {{.K}}\n",
+		"logo.png":      "{{ not a template\n",
+		"data/a.json":   "{{\n",
+		CopyFileName:    "*.png\ndata/\n",
+		"script.sh":     "#! /bin/sh\n",
+		"data/sub/b.go": "{{.K}}\n",
+	}
+	for name, text := range files {
+		p := filepath.Join(inDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(text), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outTopDir := t.TempDir()
+	g, err := New(Options{
+		TemplatePaths: []string{inDir},
+		KvpArgs:       []KvpArg{{Key: "K", Values: []string{"1"}}},
+		OutTopDir:     outTopDir,
+		Logger:        quietLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := g.ExpandTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		copied bool
+		mode   os.FileMode
+	}{
+		{"plain.txt", false, 0440},
+		{"tmpl.txt", false, 0440},
+		{"script.sh", false, 0440},
+		{"logo.png", true, 0555},
+		{"data/a.json", true, 0555},
+		{"data/sub/b.go", true, 0555},
+	}
+	if len(results) != len(tests) {
+		t.Errorf("got %d results, want %d", len(results), len(tests))
+	}
+	byPath := make(map[string]Result)
+	for _, r := range results {
+		rel, err := filepath.Rel(inDir, r.TemplatePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byPath[filepath.ToSlash(rel)] = r
+	}
+	for _, tt := range tests {
+		r, ok := byPath[tt.name]
+		if !ok {
+			t.Errorf("%s: no result", tt.name)
+			continue
+		}
+		if r.Copied != tt.copied {
+			t.Errorf("%s: got Copied %v, want %v", tt.name, r.Copied, tt.copied)
+		}
+		stat, err := os.Stat(r.OutPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Mode().Perm() != tt.mode {
+			t.Errorf("%s: got mode %v, want %v", tt.name, stat.Mode().Perm(), tt.mode)
+		}
+	}
+}
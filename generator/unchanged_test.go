@@ -0,0 +1,83 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package generator
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnchangedSkip(t *testing.T) {
+	const want = "K is 1\n"
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		onDisk    string // "" if absent
+		clobber   bool
+		unchanged bool
+		collision bool
+	}{
+		{"absent", "", false, false, false},
+		{"same content", want, false, true, false},
+		{"same content, clobber", want, true, true, false},
+		{"other content", "edited\n", false, false, true},
+		{"other content, clobber", "edited\n", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outTopDir := t.TempDir()
+			outPath := filepath.Join(outTopDir, "out.txt")
+			if tt.onDisk != "" {
+				if err := ioutil.WriteFile(outPath, []byte(tt.onDisk), 0440); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(outPath, past, past); err != nil {
+					t.Fatal(err)
+				}
+			}
+			g, err := New(Options{
+				TemplatePaths: []string{"out.txt"},
+				TemplateText:  "K is {{.K}}\n",
+				KvpArgs:       []KvpArg{{Key: "K", Values: []string{"1"}}},
+				OutTopDir:     outTopDir,
+				Clobber:       tt.clobber,
+				Logger:        quietLogger,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := g.ExpandTemplate()
+			if tt.collision {
+				var collisionErr *PathCollisionError
+				if !errors.As(err, &collisionErr) || collisionErr.ThisRun {
+					t.Fatalf("got error %v, want PathCollisionError of an earlier run", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Unchanged != tt.unchanged {
+				t.Errorf("got Unchanged %v, want %v", results[0].Unchanged, tt.unchanged)
+			}
+			got, err := ioutil.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("got content %q, want %q", got, want)
+			}
+			stat, err := os.Stat(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if untouched := stat.ModTime().Equal(past); untouched != tt.unchanged {
+				t.Errorf("got mtime %v untouched %v, want %v", stat.ModTime(), untouched, tt.unchanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+// Package diff renders line-oriented differences in unified format.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	a, b int // line indices in 'a' and 'b' respectively
+}
+
+// Unified returns the differences from 'a' to 'b' in unified format, labelled
+// 'aName' and 'bName', or "" if there are none.
+func Unified(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	aLines, bLines := splitLines(a), splitLines(b)
+	ops := editScript(aLines, bLines)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(ops); {
+		// Find next change, and extend the hunk while changes lie within
+		// twice the context of one another.
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind == opEqual {
+				continue
+			}
+			if i-end > 2*contextLines {
+				break
+			}
+			end = i
+		}
+		lo := start - contextLines
+		if lo < 0 {
+			lo = 0
+		}
+		hi := end + 1 + contextLines
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+		writeHunk(&out, ops[lo:hi], aLines, bLines)
+		start = end + 1
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op, aLines, bLines []string) {
+	aStart, bStart := ops[0].a, ops[0].b
+	var aCount, bCount int
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			aCount++
+			bCount++
+		case opDelete:
+			aCount++
+		case opInsert:
+			bCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			writeLine(out, ' ', aLines[o.a])
+		case opDelete:
+			writeLine(out, '-', aLines[o.a])
+		case opInsert:
+			writeLine(out, '+', bLines[o.b])
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeLine(out *strings.Builder, prefix byte, line string) {
+	out.WriteByte(prefix)
+	if strings.HasSuffix(line, "\n") {
+		out.WriteString(line)
+		return
+	}
+	out.WriteString(line)
+	out.WriteString("\n\\ No newline at end of file\n")
+}
+
+// splitLines splits after each newline, keeping it.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxEdits bounds the length of edit script sought, and so the time taken.
+// Inputs differing by more are reported as replaced whole.
+const maxEdits = 4000
+
+// editScript computes a shortest edit script per Myers' O(ND) algorithm, in
+// linear space, by recursion about the middle snake of each subproblem.
+func editScript(a, b []string) []op {
+	size := len(a) + len(b) + 3
+	d := &differ{a: a, b: b, vf: make([]int, size), vb: make([]int, size)}
+	if !d.compare(0, len(a), 0, len(b)) {
+		return replaceAll(a, b)
+	}
+	return d.ops
+}
+
+// replaceAll returns the edit script deleting every line of 'a', then
+// inserting every line of 'b'.
+func replaceAll(a, b []string) []op {
+	ops := make([]op, 0, len(a)+len(b))
+	for x := range a {
+		ops = append(ops, op{opDelete, x, 0})
+	}
+	for y := range b {
+		ops = append(ops, op{opInsert, len(a), y})
+	}
+	return ops
+}
+
+type differ struct {
+	a, b   []string
+	vf, vb []int // furthest x reached on each diagonal, forward and reverse
+	ops    []op
+}
+
+// compare appends the edit script from a[aLo:aHi] to b[bLo:bHi], or returns
+// false if it would exceed maxEdits.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) bool {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, op{opEqual, aLo, bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			d.ops = append(d.ops, op{opInsert, aLo, y})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			d.ops = append(d.ops, op{opDelete, x, bLo})
+		}
+	default:
+		x, y, u, v, ok := d.middleSnake(aLo, aHi, bLo, bHi)
+		if !ok || !d.compare(aLo, x, bLo, y) {
+			return false
+		}
+		for ; x < u; x, y = x+1, y+1 {
+			d.ops = append(d.ops, op{opEqual, x, y})
+		}
+		if !d.compare(u, aHi, v, bHi) {
+			return false
+		}
+	}
+	for i := 0; i < suffix; i++ {
+		d.ops = append(d.ops, op{opEqual, aHi + i, bHi + i})
+	}
+	return true
+}
+
+// middleSnake finds the snake (x,y)-(u,v) midway along a shortest edit
+// script from a[aLo:aHi] to b[bLo:bHi], both non-empty, searching forward
+// from their start and in reverse from their end until the two meet.
+// Returns false if the script would exceed maxEdits.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int, ok bool) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	offset := (n+m+1)/2 + 1
+	vf, vb := d.vf, d.vb
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		if 2*D-1 > maxEdits {
+			return 0, 0, 0, 0, false
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1] // down: insertion
+			} else {
+				x = vf[offset+k-1] + 1 // right: deletion
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			if odd && delta-k >= -(D-1) && delta-k <= D-1 && x+vb[offset+delta-k] >= n {
+				return aLo + x0, bLo + y0, aLo + x, bLo + y, true
+			}
+		}
+		// X  In reverse, x and y count lines back from the end, and
+		//    diagonal k of the reverse search is delta-k of the forward.
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+			if !odd && delta-k >= -D && delta-k <= D && x+vf[offset+delta-k] >= n {
+				return aHi - x, bHi - y, aHi - x0, bHi - y0, true
+			}
+		}
+	}
+	panic("diff: no middle snake found")
+}
+
+// Align returns, for each of 'b', the index of the line of 'a' it was found
+// to match by a shortest edit script, or -1 if inserted.
+func Align(a, b []string) []int {
+	matches := make([]int, len(b))
+	for i := range matches {
+		matches[i] = -1
+	}
+	for _, o := range editScript(a, b) {
+		if o.kind == opEqual {
+			matches[o.b] = o.a
+		}
+	}
+	return matches
+}
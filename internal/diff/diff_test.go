@@ -0,0 +1,164 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// apply applies 'ops' to 'a', failing 't' unless they consume each line of
+// 'a' in order, and their equal lines are equal.
+func apply(t *testing.T, a, b []string, ops []op) []string {
+	t.Helper()
+	var out []string
+	x := 0
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			if o.a != x || a[o.a] != b[o.b] {
+				t.Fatalf("bad equal op %+v at line %d of a", o, x)
+			}
+			out = append(out, a[o.a])
+			x++
+		case opDelete:
+			if o.a != x {
+				t.Fatalf("bad delete op %+v at line %d of a", o, x)
+			}
+			x++
+		case opInsert:
+			out = append(out, b[o.b])
+		}
+	}
+	if x != len(a) {
+		t.Fatalf("ops consumed %d of %d lines of a", x, len(a))
+	}
+	return out
+}
+
+// edits counts the inserts and deletes of 'ops'.
+func edits(ops []op) (n int) {
+	for _, o := range ops {
+		if o.kind != opEqual {
+			n++
+		}
+	}
+	return
+}
+
+// lcsEdits returns the length of a shortest edit script, by dynamic
+// programming over the longest common subsequence.
+func lcsEdits(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] > lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return len(a) + len(b) - 2*lcs[0][0]
+}
+
+func TestEditScript(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		edits int
+	}{
+		{"both empty", nil, nil, 0},
+		{"a empty", nil, []string{"x", "y"}, 2},
+		{"b empty", []string{"x", "y"}, nil, 2},
+		{"identical", []string{"x", "y", "z"}, []string{"x", "y", "z"}, 0},
+		{"disjoint", []string{"a", "b", "c"}, []string{"x", "y"}, 5},
+		{"insert middle", []string{"a", "c"}, []string{"a", "b", "c"}, 1},
+		{"delete ends", []string{"a", "b", "c"}, []string{"b"}, 2},
+		{"swap", []string{"a", "b"}, []string{"b", "a"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := editScript(tt.a, tt.b)
+			if got := apply(t, tt.a, tt.b, ops); !reflect.DeepEqual(got, tt.b) &&
+				!(len(got) == 0 && len(tt.b) == 0) {
+				t.Errorf("applied script gives %q, want %q", got, tt.b)
+			}
+			if n := edits(ops); n != tt.edits {
+				t.Errorf("got %d edits, want %d", n, tt.edits)
+			}
+		})
+	}
+}
+
+func TestEditScriptRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randLines := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randLines(), randLines()
+		ops := editScript(a, b)
+		if got := apply(t, a, b, ops); strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("a=%q b=%q: applied script gives %q", a, b, got)
+		}
+		if n, want := edits(ops), lcsEdits(a, b); n != want {
+			t.Fatalf("a=%q b=%q: got %d edits, want %d", a, b, n, want)
+		}
+	}
+}
+
+func TestEditScriptOverMaxEdits(t *testing.T) {
+	a := make([]string, maxEdits)
+	b := make([]string, maxEdits)
+	for i := range a {
+		a[i] = "a" + strconv.Itoa(i)
+		b[i] = "b" + strconv.Itoa(i)
+	}
+	ops := editScript(a, b)
+	if got := apply(t, a, b, ops); !reflect.DeepEqual(got, b) {
+		t.Fatal("applied script does not give b")
+	}
+	if n := edits(ops); n != 2*maxEdits {
+		t.Errorf("got %d edits, want %d", n, 2*maxEdits)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9"
+	want := `--- a
++++ b
+@@ -2,8 +2,8 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+-9
++9
+\ No newline at end of file
+`
+	if got := Unified("a", "b", a, b); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Unified("a", "b", a, a); got != "" {
+		t.Errorf("identical inputs: got:\n%s", got)
+	}
+}
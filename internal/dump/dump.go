@@ -0,0 +1,201 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+// Package dump implements gemp's 'dump' command.
+package dump
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/dmullis/gemp/generator"
+	"github.com/dmullis/gemp/internal"
+	"github.com/dmullis/gemp/internal/diff"
+)
+
+const usagePreamble = `command 'dump' usage:
+
+  Each Key=Value+ pair is passed, along with the general '-format=' argument,
+  to fmt.Sprintf, and the result written to stdout on a line of its own.
+  Any value list V1,V2...Vn is not expanded or parsed further but merely
+  treated as a single string, unless '-quote' is given.
+
+  Alternatively, with '-template', each pair is rendered by Go's
+  'text/template', as is each file by 'gen', and with the same functions.
+`
+
+// Args holds the parsed command line of 'dump'.
+type Args struct {
+	Check    string
+	Template string
+	Quote    bool
+
+	// Separator rejoining the Values of each K=V1,V2...Vn pair, quoted
+	// as necessary.  Defaults to internal.ValueListSeparator.
+	ValueSep string
+}
+
+// FormatError reports a '-format' argument that failed to expand some
+// Key=Value+ pair.
+type FormatError struct {
+	Format, Key, Values, Expansion string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("format (%s) failed to expand arg (%s=%s):\n\t%s\n",
+		e.Format, e.Key, e.Values, e.Expansion)
+}
+
+func newFlagSet(args *Args) *flag.FlagSet {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	fs.StringVar(&args.Check, "check", "",
+		`Path to a file previously written from stdout of 'dump'.  Instead
+of writing to stdout, compare against that file, reporting any difference
+in unified format.  Exit status is non-zero if the file is out of date.`)
+	fs.BoolVar(&args.Quote, "quote", false,
+		`Rather than each value list as given, write its Values, after any
+expansion of ranges, rejoined by '-valuesep' and quoted as necessary to be
+split again into the same Values.`)
+	fs.StringVar(&args.Template, "template", "",
+		`Instead of '-format', a template in the syntax of Go's 'text/template'
+rendering each Key=Value+ pair on a line of its own.  Available are
+{{.Key}}, {{.Type}}, {{.Value}} -- the value list, as for '-format' --
+{{.Quoted}} -- the Values rejoined as by '-quote' -- and {{.Values}}, a
+list.  Functions are those available to 'gen', e.g.
+'{{.Key | upper}}={{.Values | join " "}}'.`)
+	return fs
+}
+
+func UsageDump(helpAsMarkdown bool, cliUsage string) {
+	fmt.Fprintf(os.Stderr, "%s\n\n", usagePreamble)
+	if helpAsMarkdown {
+		internal.ToggleCode(internal.MarkdownAutoGenMessage)
+	}
+	fmt.Fprintf(os.Stderr, "%s", cliUsage)
+	newFlagSet(&Args{}).PrintDefaults()
+	if helpAsMarkdown {
+		internal.ToggleCode("")
+	}
+}
+
+// ParseArgs returns the Args specific to 'dump'.  Any error returned calls
+// for a usage message.
+func ParseArgs(dumpArgs []string) (args Args, err error) {
+	fs := newFlagSet(&args)
+	fs.SetOutput(ioutil.Discard) // X  caller reports any error
+	if err = fs.Parse(dumpArgs); err != nil {
+		return
+	}
+	if len(fs.Args()) > 0 {
+		err = fmt.Errorf("unexpected argument '%s'", fs.Args()[0])
+	}
+	return
+}
+
+// value returns the value list of 'kvp' as given, or if 'quote' or that is
+// not known, its Values rejoined by 'valueSep', quoted as necessary.
+func value(kvp internal.KvpArg, valueSep string, quote bool) string {
+	if quote || kvp.Raw == "" {
+		return internal.JoinValues(kvp.Values, valueSep)
+	}
+	return kvp.Raw
+}
+
+// Expand formats each of 'kvpArgs' per 'format', one per line, its value
+// list as found by value().
+func Expand(format, valueSep string, quote bool, kvpArgs []internal.KvpArg) (string, error) {
+	var out strings.Builder
+	for _, kvp := range kvpArgs {
+		kvpValues := value(kvp, valueSep, quote)
+		expand := fmt.Sprintf(format, kvp.Key, kvpValues)
+		if strings.HasPrefix(expand, "%!") {
+			return "", &FormatError{format, kvp.Key, kvpValues, expand}
+		}
+		out.WriteString(expand + "\n")
+	}
+	return out.String(), nil
+}
+
+// templatePair is the data presented to '-template' for each K=V1,V2...Vn.
+type templatePair struct {
+	Key, Type, Value, Quoted string
+	Values                   []string
+}
+
+// templateName identifies the '-template' argument in error messages.
+const templateName = "-template"
+
+// ExpandTemplate renders each of 'kvpArgs' by 'text', one per line, its
+// value list as found by value() for {{.Value}}, and its Values rejoined by
+// 'valueSep' for {{.Quoted}}.
+func ExpandTemplate(text, valueSep string, quote bool, kvpArgs []internal.KvpArg) (string, error) {
+	tmpl, err := template.New(templateName).Funcs(generator.Funcs()).
+		Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", &generator.TemplateParseError{TemplatePath: templateName, Err: err}
+	}
+	var out strings.Builder
+	for _, kvp := range kvpArgs {
+		pair := templatePair{
+			Key:    kvp.Key,
+			Type:   kvp.Type,
+			Value:  value(kvp, valueSep, quote),
+			Quoted: internal.JoinValues(kvp.Values, valueSep),
+			Values: kvp.Values,
+		}
+		if err := tmpl.Execute(&out, pair); err != nil {
+			return "", &generator.TemplateExecError{
+				TemplatePath: templateName,
+				Combination:  map[string]interface{}{kvp.Key: pair.Value},
+				Err:          err,
+			}
+		}
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+// Run executes 'dump' as directed by 'args', writing output or any report
+// of '-check' to 'w'.
+func Run(args Args, format string, kvpArgs []internal.KvpArg, w io.Writer) error {
+	if args.ValueSep == "" {
+		args.ValueSep = internal.ValueListSeparator
+	}
+	var expansion string
+	var err error
+	if args.Template != "" {
+		expansion, err = ExpandTemplate(args.Template, args.ValueSep, args.Quote, kvpArgs)
+	} else {
+		expansion, err = Expand(format, args.ValueSep, args.Quote, kvpArgs)
+	}
+	if err != nil {
+		return err
+	}
+	if args.Check == "" {
+		_, err = io.WriteString(w, expansion)
+		return err
+	}
+
+	onDisk, err := ioutil.ReadFile(args.Check)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(w, "missing %s\n", args.Check)
+		return &generator.CheckError{Missing: []string{args.Check}}
+	} else if err != nil {
+		return err
+	}
+	if string(onDisk) == expansion {
+		return nil
+	}
+	fd := generator.FileDiff{
+		OutPath: args.Check,
+		Diff: diff.Unified(args.Check+"\t(on disk)", args.Check+"\t(expected)",
+			string(onDisk), expansion),
+	}
+	fmt.Fprintf(w, "differs %s\n%s", fd.OutPath, fd.Diff)
+	return &generator.CheckError{Differing: []generator.FileDiff{fd}}
+}
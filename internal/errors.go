@@ -3,10 +3,7 @@
 package internal
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"log"
 	"os"
 )
 
@@ -16,17 +13,22 @@ func ToggleCode(header string) {
 	fmt.Fprintf(os.Stderr, "%s\n```\n", header)
 }
 
-func CountLines(r *os.File) (count int) {
-	_, _ = r.Seek(0, 0)
-	b := bufio.NewReader(r)
-	for ; ; count++ {
-		_, err := b.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				return
-			}
-			log.Fatalf("Could not read line from \"%s\", err=%v",
-				r.Name(), err)
-		}
+// KvSyntaxError reports a malformed Key=Value+ pair, whether found on the
+// command line or in a '-kvpluspath' file.
+type KvSyntaxError struct {
+	Source string // path of file, or "command line"
+	Line   int    // line of file, or 1-based index of command line arg; 0 if none
+	Column int    // 1-based, in characters; 0 if not known
+	Text   string // offending text
+	Reason string
+}
+
+func (e *KvSyntaxError) Error() string {
+	if e.Line <= 0 {
+		return fmt.Sprintf("%s: %s: \"%s\"", e.Source, e.Reason, e.Text)
+	}
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s: \"%s\"", e.Source, e.Line, e.Column, e.Reason, e.Text)
 	}
+	return fmt.Sprintf("%s:%d: %s: \"%s\"", e.Source, e.Line, e.Reason, e.Text)
 }
@@ -1,34 +1,30 @@
 // Copyright 2020 Donald Mullis. All rights reserved.
 
-// Gemp 'gen' recursively expands template files as directed by
-// a common pool of K=V bindings.
-//
-//    Tenets:
-//     1. Don't break runtime's understanding of source code line numbers -- strings
-//        inserted into source code by generation must not include line breaks.
+// Package gen parses the command line of gemp's 'gen' command into
+// generator.Options.
 package gen
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
 	"os"
-	"path"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
-	"text/template"
 
+	"github.com/dmullis/gemp/generator"
 	"github.com/dmullis/gemp/internal"
 )
 
 // Args specific to "gen"
-var (
-	usagePreamble = `command 'gen' usage:
+const usagePreamble = `command 'gen' usage:
 
   If a list of more than one value has been assigned to a variable 'K', 'K'
   must be expanded by the template file in order to avoid identical
-  duplicate output files.
+  duplicate output files.  Combinations yielding the same output pathname
+  must yield identical content, which is then written only once.
 
   In order to generate unique names for each output file, the Key
   introducing K=V1,V2...Vn must be made available for substitution in
@@ -38,8 +34,18 @@ var (
   K's expansion for pathnames is controlled by the general '-format='
   argument.
 
-  Elements of 'templatePath' will be split into substrings at each
-  transition from a character legal in Go identifiers '[a-zA-Z0-9_]',
+  Each template path names a file, a directory, or a glob pattern
+  matching either.  Directories are walked recursively, omitting any
+  path matched by a pattern in a '.gempignore' file, in a subset of
+  '.gitignore' syntax.  Every other file found is expanded as a
+  template, except files, or whole directories, matched by a pattern in
+  a '.gempcopy' file, of the same syntax, e.g. '*.png' or 'testdata/'.
+  These are copied through unchanged, though still to an expanded
+  pathname.
+
+  Elements of each template file's path, as given on the command line
+  or as found by walking a directory, will be split into substrings at
+  each transition from a character legal in Go identifiers '[a-zA-Z0-9_]',
   to one that is not.  Each such substring will then be tested against
   all Keys specified.  For the first matching key only, each
   of its one or more specified values will be substituted in
@@ -47,17 +53,55 @@ var (
   the base file written.  Format of generated pathnames is
   controlled by the 'format' option.
 
+  Beyond the functions built into 'text/template', templates may call:
+    case:        upper lower camel snake kebab exported unexported
+    arithmetic:  add sub mul div mod shl shr
+    strings:     join split replace trimPrefix trimSuffix repeat
+    formatting:  hex padded
+  Arguments precede the operand, as suits pipelines, e.g.
+  '{{.Name | snake}}', '{{add .UintSize 1}}', '{{.List | join ", "}}',
+  '{{padded 4 .N}}'.
+
+  Besides its K=V pairs, each expansion binds 'thisDir', the directory of
+  its output file, and 'gemp', holding:
+    .gemp.TemplatePath  .gemp.TemplateBase  template file, and its base name
+    .gemp.OutPath       .gemp.OutBase       output file, and its base name
+    .gemp.OutDir                            directory of output file
+    .gemp.Index         .gemp.Total         combination, from 0, of how many
+    .gemp.Keys          .gemp.Values        Keys in order; all Values of each
+    .gemp.Version                           of gemp
+    .gemp.Timestamp                         time of generation, UTC, per
+                                            SOURCE_DATE_EPOCH if set
+  e.g. '{{index .gemp.Values "UintSize" | len}}' or
+  '{{.gemp.Timestamp.Format "2006"}}'.  No Key may be 'gemp' or 'thisDir'.
+
   Directory names with initial '_' are useful to hide source for code
   generation from any run of "go mod tidy" initiated at the root directory.
 `
-	fs = flag.NewFlagSet("gen", flag.ExitOnError)
 
-	clobber = fs.Bool("clobber", false,
-		`Overwrite already-existing output files.`)
+// Args holds the parsed command line of 'gen'.
+type Args struct {
+	generator.Options
+
+	DataPath string
+	Plan     bool
+	PlanJSON bool
+	Prune    bool
+	Check    bool
+}
+
+// newFlagSet binds the flags of 'gen' to fields of 'args'.
+func newFlagSet(args *Args) *flag.FlagSet {
+	opts := &args.Options
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+
+	fs.BoolVar(&opts.Clobber, "clobber", false,
+		`Overwrite already-existing output files.  Files already holding
+the content to be generated are left untouched, with or without '-clobber'.`)
 
 	//   https://golang.org/pkg/path/
 	//   https://golang.org/pkg/text/template/#hdr-Arguments
-	inKeySeparator = fs.String("inkeyseparator",
+	fs.StringVar(&opts.InKeySeparator, "inkeyseparator",
 		"", // XX  no default
 		`Input files may be visually distinguished from output
 files they generate by inclusion of a specified character.  The character
@@ -70,295 +114,344 @@ Candidates for '-inkeyseparator' usage must seek a compromise:
    b. Not collide with other non-alphanums wanted within filenames.
 A few non-alphanumeric candidates: + ~ @  %`)
 
-	outTopDir = fs.String("outtopdir", ".",
+	fs.StringVar(&opts.OutTopDir, "outtopdir", ".",
 		`Top-level output directory to populate as directed by
 templatepath.`)
-	templatePath string
-)
 
-var (
-	templateText string
-)
+	fs.StringVar(&opts.Where, "where", "",
+		`Generate only combinations satisfying this expression over the Keys,
+e.g. 'UintSize >= 32 && UintOperation != "ReverseBytes"'.  Operators are
+== != < <= > >= && || ! and 'K in (V1, V2, ...)', with parentheses for
+grouping.  Operands are Keys, numbers, double-quoted strings, and
+'true' and 'false'.  Two numbers compare numerically; anything else
+compares as strings.  Under 'gemp -verbose ... gen -plan', combinations
+skipped are listed too.`)
+	fs.StringVar(&opts.Exclude, "exclude", "",
+		`Generate no combination satisfying this expression, as for '-where'.`)
+
+	fs.Var(lockstepFlag{&opts.Lockstep}, "lockstep",
+		`Comma-separated Keys whose Values advance together rather than
+multiplying, e.g. '-lockstep GoType,Max' given 'GoType=uint8,uint16
+Max=255,65535' yields only combinations uint8 255 and uint16 65535.
+All Keys of a group must have equally many Values.  May be repeated,
+one group per flag.`)
+
+	fs.Var(delimsFlag{&opts.LeftDelim, &opts.RightDelim}, "delims",
+		`Left and right delimiters of template actions, separated by white space,
+e.g. '/*{{ }}*/', so that actions sit within Go comments, leaving a template
+acceptable to 'gofmt'.  A file whose first line opens a comment of '//',
+'#' or '/*' with the directive '`+generator.DelimsDirective+` <left> <right>'
+uses those delimiters instead, that line being expanded as an empty line.  Applies also to files of
+'-include'.  Defaults to '`+generator.DefaultLeftDelim+` `+generator.DefaultRightDelim+`'.`)
+
+	fs.StringVar(&opts.Dialect, "dialect", generator.DialectTemplate,
+		`Syntax of template files and of '-include' files: '`+generator.DialectTemplate+`', that of Go's
+'text/template'; or '`+generator.DialectToken+`', in which placeholders are valid Go, so
+that a template compiles, and may be formatted and vetted, as-is:
+  GEMP_K              identifier replaced by the Value of Key K
+  /*GEMP:K*/ uint64   comment marker replaced, along with the identifier,
+                      qualified identifier, number or string following it,
+                      by the Value of K
+  ... // `+generator.OmitDirective+`     line expanded as an empty line, e.g.
+                      'type GEMP_K = uint64 // `+generator.OmitDirective+`'
+Template actions remain available alongside placeholders; '-delims' keeps
+them from colliding with Go composite literals such as '[]T{{1}}'.`)
+
+	fs.Var(includeFlag{&opts.Includes}, "include",
+		`File, directory or glob pattern of templates parsed alongside each
+template file, for invocation as '{{template "header" .}}', or to be
+overridden by a '{{block}}' of a template file.  Each file included is
+itself invocable by its path, taken relative to the directory of the
+invoking template, or else to the working directory.  Files included are not
+themselves expanded, even if also found among the template paths.  The
+output of each '{{define}}' or '{{block}}' must span exactly as many
+lines as its body; pad a call site with comment lines where a partial
+spans more than one.  May be repeated.`)
+
+	fs.StringVar(&args.DataPath, "data", "",
+		`Path of a JSON file holding an object whose members are made available
+to every template alongside the K=V bindings, e.g. {"Ops": ["Reverse"]}
+allows '{{range .Ops}}'.  Nested objects and arrays are permitted;
+numbers written without a decimal point or exponent are taken as 'int',
+others, e.g. 1.0 or 1e3, as 'float64'.  Member names must not collide
+with any Key.  Only K=V pairs multiply output files.`)
+
+	fs.BoolVar(&opts.NoTypeGuess, "notypeguess", false,
+		`Take Values of any Key not declared as K:Type=V1,V2...Vn as strings,
+rather than as 'int' wherever they parse as decimal integers.`)
+
+	fs.StringVar(&opts.LineMode, "linemode", generator.LineModeStrict,
+		`'`+generator.LineModeStrict+`': each output file must span exactly as many lines as its
+template, and each partial as its body.  '`+generator.LineModeDirectives+`': output may
+differ in length, as by multi-line Values, '{{range}}' or '-include'; wherever
+its lines part company with those of the template, a directive naming the
+template file and line is inserted, '//line' for Go or '#line' for C-like
+output, so that compiler diagnostics and stack traces still point into the
+template.  Template files are named relative to the output file.  Outputs
+of other extensions remain held to '`+generator.LineModeStrict+`'.  A directive must
+not fall within a multi-line string or comment.`)
+
+	fs.StringVar(&opts.LineCheck, "linecheck", generator.LineCheckError,
+		`Severity of an output file, under '-linemode `+generator.LineModeStrict+`', spanning more or
+fewer lines than its template:  '`+generator.LineCheckOff+`', '`+generator.LineCheckWarn+`' to log it and carry on,
+or '`+generator.LineCheckError+`', exiting with status 6.  Either report names the first
+template line, and action, whose expansion spanned more or fewer lines, and
+any Key referenced there whose Value holds a newline.  Relax it for outputs
+that are not source code.`)
+
+	fs.BoolVar(&opts.GoFormat, "gofmt", false,
+		`Format each expanded '.go' file as does 'gofmt', before the check of its
+line count.  A file that fails to format is reported at the line of its
+template, with exit status 9.`)
+	fs.Var(formatterFlag{&opts.Formatters}, "formatter",
+		`Register 'ext=command' to format each expanded file of extension 'ext',
+e.g. -formatter 'py=black -q -'.  The command is run by 'sh -c', reading
+the file on stdin and writing it formatted to stdout.  Any line number
+found in its stderr as ':LINE:' is reported as that of the template.
+Overrides '-gofmt' for its extension.  May be repeated.`)
+
+	fs.StringVar(&opts.ManifestName, "manifest", "",
+		`Name of a JSON manifest to write below '-outtopdir', recording for
+each output file its template, the template's SHA-256, the combination of
+values, the SHA-256 of its content, and its line count.
+Conventionally '`+generator.DefaultManifestName+`'.`)
+
+	fs.BoolVar(&args.Plan, "plan", false,
+		`Write to stdout each combination, and the output path it resolves to,
+without creating any directory or file.  Combinations sharing an output
+path are rendered in memory, failing as would 'gen' unless all agree.
+Those after the first are listed apart as duplicates, and are not counted
+in the total of files to be written.`)
+	fs.BoolVar(&args.PlanJSON, "json", false,
+		`Format '-plan' output as JSON.`)
+	fs.IntVar(&opts.Jobs, "j", 0,
+		`Number of combinations rendered and written concurrently.
+Zero selects the number of CPUs available.  Logs and results are
+reported in order of enumeration regardless, and the first error
+cancels any later combinations not yet begun.`)
+
+	fs.BoolVar(&args.Check, "check", false,
+		`Write nothing, but compare each output file as it would be generated
+against that on disk, reporting any missing, differing, or -- if the
+manifest of an earlier run is found, named by '-manifest' or else
+'`+generator.DefaultManifestName+`' -- extra files.  Differences are written
+to stdout in unified format.  Exit status is non-zero if any file is
+out of date.`)
+	fs.BoolVar(&args.Prune, "prune", false,
+		`Before generating, remove each output file recorded by the manifest of
+an earlier run which is no longer generated, along with any directories
+thereby left empty.  Files not recorded in the manifest, or modified since
+generation, are never removed.  Implies '-manifest=`+generator.DefaultManifestName+`'
+if '-manifest' not given.  With '-plan', lists files to be removed.`)
+	return fs
+}
 
-type (
-	recursionContext struct {
-		// XX  Copies of general args to command
-		verbose bool
-		format  string
-
-		kvpArgs    []internal.KvpArg
-		templLines int
-
-		// Immutable after compilation of this file.
-		//    https://golang.org/pkg/text/template/#hdr-Arguments
-		tmpl *template.Template
-
-		// Immutable after parsing of command line.
-		// Selects which of 'kvpArgs' is exposed in name of output pathname
-		//splitBaseFile,
-		splitBaseDir []string // split at each '*inKeySeparator'
-
-		// mutating state, changes at each iteration step
-		//  X  Why a map rather than slice of K=V pairs?
-		//       =>  Because template.Execute() doesn't understand
-		//           the latter -- apparently reliant upon runtime type information.
-		//         cf. https://golang.org/pkg/text/template/#Template.Execute
-		//  X  Why indexed with base type 'string' rather than some
-		//     defined type equivalent e.g. 'Key'?
-		//       => Not acceptable to template.Execute():
-		//              executing "singleton template" at <.CodeGenWarning>: can't
-		//              evaluate field CodeGenWarning in type map[main.Key]string
-		//         cf. https://golang.org/pkg/text/template/#hdr-Arguments
-
-		// X  Provide template.Execute() with 'int' type if possible; otherwise 'string'.
-		substitutions_var map[string]interface{}
-	}
-)
+// lockstepFlag appends one group of Keys per use of '-lockstep'.
+type lockstepFlag struct {
+	groups *[][]string
+}
 
-func UsageDump(helpAsMarkdown bool, cliUsage string) {
-	fmt.Fprintf(os.Stderr, "%s\n\n", usagePreamble)
-	if helpAsMarkdown {
-		internal.ToggleCode(internal.MarkdownAutoGenMessage)
+func (f lockstepFlag) String() string {
+	if f.groups == nil {
+		return ""
 	}
-	fmt.Fprintf(os.Stderr, "%s", cliUsage)
-	fs.PrintDefaults()
-	if helpAsMarkdown {
-		internal.ToggleCode("")
+	var groups []string
+	for _, keys := range *f.groups {
+		groups = append(groups, strings.Join(keys, internal.ValueListSeparator))
 	}
+	return strings.Join(groups, " ")
 }
 
-func ParseArgs(genArgs []string, cliUsage string) (templLines int) {
-	fs.Usage = func() {
-		UsageDump(false, cliUsage)
-		os.Exit(1)
+func (f lockstepFlag) Set(value string) error {
+	keys := strings.Split(value, internal.ValueListSeparator)
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("empty Key in lockstep group '%s'", value)
+		}
 	}
+	*f.groups = append(*f.groups, keys)
+	return nil
+}
 
-	usageWhy := func(why string) {
-		UsageDump(false, cliUsage)
-		fmt.Fprintf(os.Stderr, "gen command args: '%v'\n\n", genArgs)
-		fmt.Fprintf(os.Stderr, "\n%s\n\n", why)
-		os.Exit(1)
-	}
+// delimsFlag sets both action delimiters from one '-delims' argument.
+type delimsFlag struct {
+	left, right *string
+}
 
-	// X Flags required to precede all args other than the initial templatePath.
-	//      After parsing, the arguments following the flags are available as
-	//      the slice flag.Args() or individually as flag.Arg(i).
-	//         https://golang.org/pkg/flag/#Args
-	err := fs.Parse(genArgs)
-	if err != nil {
-		usageWhy(err.Error())
+func (f delimsFlag) String() string {
+	if f.left == nil || *f.left == "" {
+		return ""
 	}
+	return *f.left + " " + *f.right
+}
 
-	if nArgs := len(fs.Args()); nArgs < 1 {
-		usageWhy("no path to template file found")
-	} else if nArgs > 1 {
-		usageWhy(fmt.Sprintf(
-			"non-flag argument '%s' is not last arg on command line",
-			fs.Args()[0]))
+func (f delimsFlag) Set(value string) error {
+	delims := strings.Fields(value)
+	if len(delims) != 2 {
+		return fmt.Errorf("expected left and right delimiters separated by white space, found '%s'", value)
 	}
-	templatePath = fs.Args()[0]
-	templLines, templateText = getTemplate(templatePath)
-	return
+	*f.left, *f.right = delims[0], delims[1]
+	return nil
 }
 
-func getTemplate(templatePath string) (int, string) {
-	var err error
-	var infile *os.File
-	if infile, err = os.Open(templatePath); err != nil {
-		log.Fatalf("Could not open input file \"%s\", err=%v",
-			templatePath, err)
-	}
-	var stat os.FileInfo
-	stat, err = infile.Stat()
-	if err != nil {
-		log.Fatalln(err)
-	}
-	templateText := make([]byte, stat.Size())
-	var nRead int
-	if nRead, err = infile.Read(templateText); err != nil {
-		log.Fatalf("Could not os.Read %s, err=%v", templatePath, err)
-	}
-	if nRead <= 0 {
-		log.Fatalf("os.Read returned %d bytes", nRead)
+// formatterFlag adds one command per use of '-formatter'.
+type formatterFlag struct {
+	formatters *map[string]string
+}
+
+func (f formatterFlag) String() string {
+	if f.formatters == nil {
+		return ""
 	}
-	templLines := internal.CountLines(infile)
-	if err = infile.Close(); err != nil {
-		log.Fatalf("Could not close %v, err=%v", infile, err)
+	var pairs []string
+	for ext, command := range *f.formatters {
+		pairs = append(pairs, ext+"="+command)
 	}
-	return templLines, string(templateText)
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
 }
 
-func ExpandTemplate(verbose bool, format string, templLines int,
-	kvpArgs []internal.KvpArg) {
-
-	ctx := recursionContext{
-		verbose:    verbose,
-		format:     format,
-		kvpArgs:    kvpArgs,
-		templLines: templLines,
-		splitBaseDir:      split(templatePath),
-		substitutions_var: make(map[string]interface{}, 0),
+func (f formatterFlag) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected ext=command, found '%s'", value)
 	}
-
-	if *inKeySeparator != "" {
-		ctx.splitBaseDir = exciseChar(ctx.splitBaseDir)
+	ext := value[:i]
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
 	}
-
-	var err error
-	ctx.tmpl, err = template.New("" /*baseFile*/).Option("missingkey=error").
-		Parse(templateText)
-	if err != nil {
-		log.Fatalln(err)
+	if *f.formatters == nil {
+		*f.formatters = make(map[string]string)
 	}
-	ctx.recurse(0)
+	(*f.formatters)[ext] = value[i+1:]
+	return nil
 }
 
-func split(path string) []string {
-	keysRE := regexp.MustCompile(`[a-zA-Z0-9_]+|[^a-zA-Z0-9_]+`)
-	return keysRE.FindAllString(path, -1)
+// includeFlag appends one path per use of '-include'.
+type includeFlag struct {
+	paths *[]string
 }
 
-func exciseChar(frags []string) []string {
-	//	separatorRE := regexp.MustCompile(`[` + *inKeySeparator + `]`)
-	for ifrag := range frags {
-		frags[ifrag] = strings.ReplaceAll(frags[ifrag], *inKeySeparator, "")
+func (f includeFlag) String() string {
+	if f.paths == nil {
+		return ""
 	}
-	return frags
+	return strings.Join(*f.paths, " ")
 }
 
-// X  Recursion here enumerates the combinations implied by the command-line
-//    arguments K1=V11,V12,... K2=V21,V22,V23,... ...
-//    This recursion is independent of any directory+file hierarchy specified
-//    by 'templatePath'.
-func (ctx *recursionContext) recurse(argIndex int) {
-	// list of parameter values complete, so write out the file
-	if argIndex == len(ctx.kvpArgs) {
-		ctx.writeFile(argIndex)
-		return
-	}
-
-	// Iterate from 'min' to 'max' for this 'argIndex' (and recursion level).
-	eArg := &ctx.kvpArgs[argIndex]
-	for _, enumVal := range eArg.Values {
-		// XX  Document this data type conversion, and its effect on output.
-		if intV, err := strconv.Atoi(enumVal); err == nil {
-			ctx.substitutions_var[eArg.Key] = intV
-		} else {
-			ctx.substitutions_var[eArg.Key] = enumVal
-		}
+func (f includeFlag) Set(value string) error {
+	*f.paths = append(*f.paths, value)
+	return nil
+}
 
-		ctx.recurse(argIndex + 1)
+func UsageDump(helpAsMarkdown bool, cliUsage string) {
+	fmt.Fprintf(os.Stderr, "%s\n\n", usagePreamble)
+	if helpAsMarkdown {
+		internal.ToggleCode(internal.MarkdownAutoGenMessage)
+	}
+	fmt.Fprintf(os.Stderr, "%s", cliUsage)
+	newFlagSet(&Args{}).PrintDefaults()
+	if helpAsMarkdown {
+		internal.ToggleCode("")
 	}
 }
 
-func (ctx *recursionContext) substituteNames(splits []string) (
-	fragmentsSubstituted []string, err error) {
+// ParseArgs returns the Args specific to 'gen'.  Options common to all
+// commands, e.g. 'Format' and 'KvpArgs', are left for the caller to fill in.
+// Any error returned calls for a usage message.
+func ParseArgs(genArgs []string) (args Args, err error) {
+	fs := newFlagSet(&args)
+	fs.SetOutput(ioutil.Discard) // X  caller reports any error
 
-	substitutions := 0
-	for _, field := range splits {
-		val, ok := ctx.substitutions_var[field]
-		if !ok {
-			fragmentsSubstituted = append(fragmentsSubstituted,
-				field)
-			continue
-		}
+	// X Flags required to precede all template paths.
+	//      After parsing, the arguments following the flags are available as
+	//      the slice flag.Args() or individually as flag.Arg(i).
+	//         https://golang.org/pkg/flag/#Args
+	if err = fs.Parse(genArgs); err != nil {
+		return
+	}
 
-		var vStr string
-		switch v := val.(type) {
-		case int:
-			vStr = strconv.Itoa(v)
-		case string:
-			vStr = v
+	if len(fs.Args()) < 1 {
+		err = errors.New("no path to template file found")
+		return
+	}
+	for _, arg := range fs.Args() {
+		if strings.HasPrefix(arg, "-") {
+			err = fmt.Errorf(
+				"flag '%s' follows a template path on command line", arg)
+			return
 		}
-		fragmentsSubstituted = append(fragmentsSubstituted,
-			fmt.Sprintf(ctx.format, field, vStr))
-		substitutions++
 	}
-	if substitutions == 0 && len(splits) > 0 {
-		err = fmt.Errorf("WARNING: no substitutions made for pattern %v",
-			splits)
+	switch args.Dialect {
+	case generator.DialectTemplate, generator.DialectToken:
+	default:
+		err = fmt.Errorf("-dialect '%s' not one of: %s",
+			args.Dialect, strings.Join(generator.Dialects, " "))
+		return
 	}
-	return
-}
-
-func (ctx *recursionContext) writeFile(argIndex int) (outDir string) {
-
-	buildOutPath := func(fragments []string) (segment string) {
-		fragmentsSubstituted, err := ctx.substituteNames(fragments)
-		if err != nil {
-			log.Println(err)
-		}
-		segment = strings.Join(fragmentsSubstituted, "")
+	switch args.LineMode {
+	case generator.LineModeStrict, generator.LineModeDirectives:
+	default:
+		err = fmt.Errorf("-linemode '%s' not one of: %s",
+			args.LineMode, strings.Join(generator.LineModes, " "))
 		return
 	}
-
-	outPathnameBottom := buildOutPath(ctx.splitBaseDir)
-	outBottomDir := path.Dir(outPathnameBottom)
-	outDir = *outTopDir + "/" + outBottomDir
-
-	if err := os.MkdirAll(outDir, 0750); err != nil {
-		log.Fatal(err)
+	switch args.LineCheck {
+	case generator.LineCheckOff, generator.LineCheckWarn, generator.LineCheckError:
+	default:
+		err = fmt.Errorf("-linecheck '%s' not one of: %s",
+			args.LineCheck, strings.Join(generator.LineChecks, " "))
+		return
 	}
+	args.TemplatePaths = fs.Args()
+	return
+}
 
-	// Make these synthetic K=V pairs available to the template.
-	// XX  Which are useful?  How to document?
-	ctx.substitutions_var["thisDir"] = path.Clean(outDir)
-	//ctx.substitutions_var["parentDir"] = path.Dir(path.Clean(outDir))
-
-	if ctx.verbose {
-		log.Printf("Combination map:\n%s", ctx.formatMap())
+// Run executes 'gen' as directed by 'args', writing any report to 'w'.
+func Run(args Args, w io.Writer) error {
+	if args.Prune && args.ManifestName == "" {
+		args.ManifestName = generator.DefaultManifestName
 	}
-
-	outBaseName := path.Base(outPathnameBottom)
-	outPath := outDir + "/" + outBaseName
-
-	_, err := os.Stat(outPath)
-	if err == nil {
-		if !*clobber {
-			log.Fatalf("Output file already exists: '%s'", outPath)
+	if args.DataPath != "" {
+		data, err := generator.ReadData(args.DataPath)
+		if err != nil {
+			return err
 		}
-		// X  If already existing, allow truncation by os.Create(), but no other
-		//    operations.
-		_ = os.Chmod(outPath, 0600)
+		args.Data = data
 	}
-	outFile, err := os.Create(outPath)
-
+	g, err := generator.New(args.Options)
 	if err != nil {
-		log.Fatalf("Failed to create output file '%s', err='%v'",
-			outPath, err)
-	}
-	if err := ctx.tmpl.Execute(outFile, ctx.substitutions_var); err != nil {
-		fmt.Fprintf(os.Stderr, "Template.Execute(outfile, map) returned  err=\n   %v", err)
-		fmt.Fprintf(os.Stderr, "Contents of failing map:\n%s", ctx.formatMap())
-		log.Fatalln("FATAL")
+		return err
 	}
-	// X  Turn off 'w' bits, as a reminder to later readers of the output that file
-	//    should not be edited.
-	if err := outFile.Chmod(0440); err != nil {
-		log.Fatal(err)
-	}
-
-	outLines := internal.CountLines(outFile)
-	wrongCount := func() {
-		log.Fatalf("outLines(%d) != ctx.templLines(%d), outPath=%s, templatePath=%s",
-			outLines, ctx.templLines, outPath, templatePath)
+	if args.Plan {
+		entries, err := g.Plan()
+		if err != nil {
+			return err
+		}
+		var stale []string
+		if args.Prune {
+			if stale, err = g.StaleOutputs(); err != nil {
+				return err
+			}
+		}
+		return writePlan(w, entries, stale, args.PlanJSON, args.Verbose)
 	}
-
-	// should line count disagreement be fatal error?
-	if outLines > ctx.templLines {
-		wrongCount()
-	} else if outLines < ctx.templLines {
-		wrongCount()
+	if args.Check {
+		err := g.Check()
+		var checkErr *generator.CheckError
+		if errors.As(err, &checkErr) {
+			writeCheck(w, checkErr)
+		}
+		return err
 	}
-	if err := outFile.Close(); err != nil {
-		log.Fatal(err)
+	if args.Prune {
+		if _, err := g.Prune(); err != nil {
+			return err
+		}
 	}
-	return
-}
-
-func (ctx *recursionContext) formatMap() (out string) {
-	for k, v := range ctx.substitutions_var {
-		out += fmt.Sprintf("   % 20s %15T '%v'\n", k, v, v)
+	results, err := g.ExpandTemplate()
+	if err != nil {
+		return err
 	}
-	return
+	return writeCounts(w, results)
 }
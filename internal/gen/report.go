@@ -0,0 +1,125 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/dmullis/gemp/generator"
+)
+
+// writePlan writes 'entries', omitting those Skipped unless 'verbose'.
+// Entries Duplicate of an earlier output path are listed after the others,
+// and are not counted in the total of files to be written.
+func writePlan(w io.Writer, entries []generator.PlanEntry, stale []string, asJSON, verbose bool) error {
+	var shown, duplicates []generator.PlanEntry
+	var total, skipped int
+	for _, e := range entries {
+		switch {
+		case e.Skipped:
+			skipped++
+		case e.Duplicate:
+			duplicates = append(duplicates, e)
+			continue
+		default:
+			total++
+		}
+		if !e.Skipped || verbose {
+			shown = append(shown, e)
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		// X  encoding/json sorts the Keys of each combination map.
+		return enc.Encode(struct {
+			Entries    []generator.PlanEntry `json:"entries"`
+			Duplicates []generator.PlanEntry `json:"duplicates,omitempty"`
+			Prune      []string              `json:"prune,omitempty"`
+			Total      int                   `json:"total"`
+			Skipped    int                   `json:"skipped,omitempty"`
+		}{shown, duplicates, stale, total, skipped})
+	}
+
+	n := 0
+	for _, e := range shown {
+		index := "   -"
+		if !e.Skipped {
+			n++
+			index = fmt.Sprintf("%4d", n)
+		}
+		note := ""
+		if e.Skipped {
+			note = " (skipped)"
+		} else if e.Copied {
+			note = " (copied)"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n       %s -> %s%s\n",
+			index, formatCombination(e.Combination), e.TemplatePath, e.OutPath, note); err != nil {
+			return err
+		}
+	}
+	for _, e := range duplicates {
+		if _, err := fmt.Fprintf(w, "   = %s\n       %s -> %s (duplicate)\n",
+			formatCombination(e.Combination), e.TemplatePath, e.OutPath); err != nil {
+			return err
+		}
+	}
+	for _, outPath := range stale {
+		if _, err := fmt.Fprintf(w, "prune %s\n", outPath); err != nil {
+			return err
+		}
+	}
+	counts := fmt.Sprintf("total: %d", total)
+	if len(duplicates) > 0 {
+		counts += fmt.Sprintf(", duplicate: %d", len(duplicates))
+	}
+	if skipped > 0 {
+		counts += fmt.Sprintf(", skipped: %d", skipped)
+	}
+	_, err := fmt.Fprintln(w, counts)
+	return err
+}
+
+// formatCombination renders a combination map on one line, sorted by Key.
+func formatCombination(m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]string, len(keys))
+	for i, k := range keys {
+		kvs[i] = fmt.Sprintf("%s=%v", k, m[k])
+	}
+	return strings.Join(kvs, " ")
+}
+
+func writeCheck(w io.Writer, checkErr *generator.CheckError) {
+	for _, outPath := range checkErr.Missing {
+		fmt.Fprintf(w, "missing %s\n", outPath)
+	}
+	for _, outPath := range checkErr.Extra {
+		fmt.Fprintf(w, "extra %s\n", outPath)
+	}
+	for _, fd := range checkErr.Differing {
+		fmt.Fprintf(w, "differs %s\n%s", fd.OutPath, fd.Diff)
+	}
+}
+
+func writeCounts(w io.Writer, results []generator.Result) error {
+	var unchanged int
+	for _, r := range results {
+		if r.Unchanged {
+			unchanged++
+		}
+	}
+	_, err := fmt.Fprintf(w, "written: %d, unchanged: %d\n",
+		len(results)-unchanged, unchanged)
+	return err
+}
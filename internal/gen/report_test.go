@@ -0,0 +1,69 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dmullis/gemp/generator"
+)
+
+func TestWritePlanCounts(t *testing.T) {
+	k1, k2 := map[string]interface{}{"K": 1}, map[string]interface{}{"K": 2}
+	entries := []generator.PlanEntry{
+		{TemplatePath: "a", Combination: k1, OutPath: "out/a1"},
+		{TemplatePath: "a", Combination: k2, OutPath: "out/a2", Skipped: true},
+		{TemplatePath: "b", Combination: k1, OutPath: "out/b"},
+		{TemplatePath: "b", Combination: k2, OutPath: "out/b", Duplicate: true},
+	}
+	tests := []struct {
+		verbose bool
+		want    string
+	}{
+		{false, `   1 K=1
+       a -> out/a1
+   2 K=1
+       b -> out/b
+   = K=2
+       b -> out/b (duplicate)
+total: 2, duplicate: 1, skipped: 1
+`},
+		{true, `   1 K=1
+       a -> out/a1
+   - K=2
+       a -> out/a2 (skipped)
+   2 K=1
+       b -> out/b
+   = K=2
+       b -> out/b (duplicate)
+total: 2, duplicate: 1, skipped: 1
+`},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := writePlan(&out, entries, nil, false, tt.verbose); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("verbose %v: got:\n%s\nwant:\n%s", tt.verbose, out.String(), tt.want)
+		}
+	}
+}
+
+func TestWritePlanJSONCounts(t *testing.T) {
+	entries := []generator.PlanEntry{
+		{TemplatePath: "b", OutPath: "out/b"},
+		{TemplatePath: "b", OutPath: "out/b", Duplicate: true},
+	}
+	var out bytes.Buffer
+	if err := writePlan(&out, entries, nil, true, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"duplicates": [`, `"duplicate": true`, `"total": 1`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no %s in:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+// Package kvfile parses the Key=Value+ assignments of a '-kvpluspath' file,
+// written in a subset of POSIX 'sh' syntax:
+//
+//	# comment
+//	export A=1 B='two words'
+//	C="multi-line
+//	value, with $A and ${B} expanded" D=x\ y  # trailing comment
+//
+// Supported are single and double quotes, possibly spanning lines,
+// backslash escapes, line continuations, several assignments per line,
+// 'export', and expansion of $NAME and ${NAME}.  A NAME is resolved first
+// against earlier assignments in the file, then against the environment;
+// if neither, it expands to "".  Command substitution, other parameter
+// expansions, and any command other than an assignment are rejected.
+//
+// As extensions to 'sh', a NAME may be followed by ':Type', as for
+// K:Type=V1,V2...Vn on the command line; and '=' may be preceded by '+' or
+// '-', appending to or removing from the Values of earlier assignments.
+package kvfile
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dmullis/gemp/internal"
+)
+
+// Assignment is one NAME=value assignment, with any quoting removed, and
+// any expansion done.
+type Assignment struct {
+	Name  string // including any ':Type'
+	Op    string // "=", "+=" or "-="
+	Value string
+	Line  int // of NAME, 1-based
+}
+
+type parser struct {
+	source    string
+	src       string
+	off       int
+	lookupEnv func(string) (string, bool)
+	vars      map[string]string
+}
+
+// Parse returns the assignments of 'src', read from 'source', in order.
+// 'lookupEnv' resolves NAMEs not assigned in 'src', as does os.LookupEnv.
+func Parse(source string, src []byte, lookupEnv func(string) (string, bool)) (
+	[]Assignment, error) {
+
+	p := &parser{
+		source:    source,
+		src:       string(src),
+		lookupEnv: lookupEnv,
+		vars:      make(map[string]string),
+	}
+	var assignments []Assignment
+
+	exporting := false
+	for {
+		p.skipBlanks()
+		if p.off >= len(p.src) {
+			return assignments, nil
+		}
+		switch p.src[p.off] {
+		case '\n', ';':
+			p.off++
+			exporting = false
+			continue
+		case '#':
+			for p.off < len(p.src) && p.src[p.off] != '\n' {
+				p.off++
+			}
+			continue
+		case '|', '&', '<', '>', '(', ')':
+			return nil, p.errorAt(p.off, "shell operator '%c' not supported", p.src[p.off])
+		}
+
+		start := p.off
+		name := p.scanName(true)
+		if name == "export" && p.atWordEnd() {
+			exporting = true
+			continue
+		}
+		op := "="
+		for _, candidate := range []string{"+=", "-=", "="} {
+			if strings.HasPrefix(p.src[p.off:], candidate) {
+				op = candidate
+				break
+			}
+		}
+		if name == "" || !strings.HasPrefix(p.src[p.off:], op) {
+			if exporting && name != "" && p.atWordEnd() {
+				continue // X  'export NAME' of a variable already assigned
+			}
+			return nil, p.errorAt(start, "expected NAME=value assignment")
+		}
+		p.off += len(op)
+		value, err := p.scanWord()
+		if err != nil {
+			return nil, err
+		}
+
+		baseName := name
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			baseName = name[:i]
+		}
+		// X  Expansion sees only plain assignments, not lists amended.
+		if op == "=" {
+			p.vars[baseName] = value
+		}
+		assignments = append(assignments, Assignment{
+			Name:  name,
+			Op:    op,
+			Value: value,
+			Line:  p.line(start),
+		})
+	}
+}
+
+func (p *parser) errorAt(off int, format string, a ...interface{}) error {
+	lineStart := strings.LastIndexByte(p.src[:off], '\n') + 1
+	lineEnd := strings.IndexByte(p.src[off:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(p.src)
+	} else {
+		lineEnd += off
+	}
+	return &internal.KvSyntaxError{
+		Source: p.source,
+		Line:   p.line(off),
+		Column: utf8.RuneCountInString(p.src[lineStart:off]) + 1,
+		Text:   p.src[lineStart:lineEnd],
+		Reason: fmt.Sprintf(format, a...),
+	}
+}
+
+func (p *parser) line(off int) int {
+	return strings.Count(p.src[:off], "\n") + 1
+}
+
+// skipBlanks skips spaces, tabs and line continuations.
+func (p *parser) skipBlanks() {
+	for p.off < len(p.src) {
+		switch {
+		case p.src[p.off] == ' ' || p.src[p.off] == '\t':
+			p.off++
+		case strings.HasPrefix(p.src[p.off:], "\\\n"):
+			p.off += 2
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) atWordEnd() bool {
+	return p.off >= len(p.src) || strings.IndexByte(" \t\n;#", p.src[p.off]) >= 0 ||
+		strings.HasPrefix(p.src[p.off:], "\\\n")
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// scanName scans a NAME, with any ':Type' if 'typed', or returns "".
+func (p *parser) scanName(typed bool) string {
+	start := p.off
+	if p.off >= len(p.src) || !isNameStart(p.src[p.off]) {
+		return ""
+	}
+	for p.off < len(p.src) && isNameChar(p.src[p.off]) {
+		p.off++
+	}
+	if typed && p.off+1 < len(p.src) && p.src[p.off] == ':' && isNameStart(p.src[p.off+1]) {
+		p.off++
+		for p.off < len(p.src) && isNameChar(p.src[p.off]) {
+			p.off++
+		}
+	}
+	return p.src[start:p.off]
+}
+
+// scanWord scans the value of an assignment, up to unquoted white space,
+// newline, ';' or end of input.
+func (p *parser) scanWord() (string, error) {
+	var value strings.Builder
+	for p.off < len(p.src) {
+		c := p.src[p.off]
+		switch c {
+		case ' ', '\t', '\n', ';':
+			return value.String(), nil
+		case '\\':
+			if p.off+1 >= len(p.src) {
+				return "", p.errorAt(p.off, "backslash at end of input")
+			}
+			if p.src[p.off+1] != '\n' {
+				value.WriteByte(p.src[p.off+1])
+			}
+			p.off += 2
+		case '\'':
+			end := strings.IndexByte(p.src[p.off+1:], '\'')
+			if end < 0 {
+				return "", p.errorAt(p.off, "unterminated single quote")
+			}
+			value.WriteString(p.src[p.off+1 : p.off+1+end])
+			p.off += end + 2
+		case '"':
+			if err := p.scanDoubleQuoted(&value); err != nil {
+				return "", err
+			}
+		case '$':
+			if err := p.expand(&value); err != nil {
+				return "", err
+			}
+		case '`':
+			return "", p.errorAt(p.off, "command substitution not supported")
+		case '|', '&', '<', '>', '(', ')':
+			return "", p.errorAt(p.off, "shell operator '%c' not supported", c)
+		default:
+			value.WriteByte(c)
+			p.off++
+		}
+	}
+	return value.String(), nil
+}
+
+func (p *parser) scanDoubleQuoted(value *strings.Builder) error {
+	open := p.off
+	p.off++
+	for p.off < len(p.src) {
+		c := p.src[p.off]
+		switch c {
+		case '"':
+			p.off++
+			return nil
+		case '\\':
+			// X  Within double quotes, backslash escapes only these.
+			if p.off+1 < len(p.src) && strings.IndexByte("$`\"\\\n", p.src[p.off+1]) >= 0 {
+				if p.src[p.off+1] != '\n' {
+					value.WriteByte(p.src[p.off+1])
+				}
+				p.off += 2
+			} else {
+				value.WriteByte(c)
+				p.off++
+			}
+		case '$':
+			if err := p.expand(value); err != nil {
+				return err
+			}
+		case '`':
+			return p.errorAt(p.off, "command substitution not supported")
+		default:
+			value.WriteByte(c)
+			p.off++
+		}
+	}
+	return p.errorAt(open, "unterminated double quote")
+}
+
+// expand expands the parameter whose '$' is at the current offset.  A '$'
+// introducing no NAME is taken literally.
+func (p *parser) expand(value *strings.Builder) error {
+	dollar := p.off
+	p.off++
+	var name string
+	switch {
+	case p.off < len(p.src) && p.src[p.off] == '{':
+		p.off++
+		name = p.scanName(false)
+		if p.off >= len(p.src) || p.src[p.off] != '}' || name == "" {
+			return p.errorAt(dollar, "parameter expansion other than ${NAME} not supported")
+		}
+		p.off++
+	case p.off < len(p.src) && p.src[p.off] == '(':
+		return p.errorAt(dollar, "command substitution not supported")
+	default:
+		if name = p.scanName(false); name == "" {
+			value.WriteByte('$')
+			return nil
+		}
+	}
+	if v, ok := p.vars[name]; ok {
+		value.WriteString(v)
+	} else if v, ok := p.lookupEnv(name); ok {
+		value.WriteString(v)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package kvfile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dmullis/gemp/internal"
+)
+
+var testEnv = map[string]string{
+	"HOME": "/home/u",
+	"A":    "from-env",
+}
+
+func lookupTestEnv(name string) (string, bool) {
+	v, ok := testEnv[name]
+	return v, ok
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Assignment
+	}{
+		{"empty", "", nil},
+		{"comments and blank lines", "# comment\n\n  # indented\n", nil},
+		{"plain", "K=V1,V2\n", []Assignment{{"K", "=", "V1,V2", 1}}},
+		{"empty value", "K=\n", []Assignment{{"K", "=", "", 1}}},
+		{"several per line", "A=1 B=2; C=3\n", []Assignment{
+			{"A", "=", "1", 1}, {"B", "=", "2", 1}, {"C", "=", "3", 1}}},
+		{"trailing comment", "K=V # comment\n", []Assignment{{"K", "=", "V", 1}}},
+		{"hash within word", "K=a#b\n", []Assignment{{"K", "=", "a#b", 1}}},
+		{"export", "export A=1 B=2\nexport A\n", []Assignment{
+			{"A", "=", "1", 1}, {"B", "=", "2", 1}}},
+		{"typed", "K:int=1,2\n", []Assignment{{"K:int", "=", "1,2", 1}}},
+		{"append and remove", "K=a,b\nK+=c\nK-=a\n", []Assignment{
+			{"K", "=", "a,b", 1}, {"K", "+=", "c", 2}, {"K", "-=", "a", 3}}},
+
+		{"single quotes", `K='a b $A \n'`, []Assignment{{"K", "=", `a b $A \n`, 1}}},
+		{"double quotes", `K="a b \"q\" \\ \$A \n"`, []Assignment{{"K", "=", `a b "q" \ $A \n`, 1}}},
+		{"adjacent quotes", `K=a'b c'"d e"f`, []Assignment{{"K", "=", "ab cd ef", 1}}},
+		{"backslash escapes", `K=a\ b\$A\"\\`, []Assignment{{"K", "=", `a b$A"\`, 1}}},
+		{"single quote across lines", "K='a\nb'\nL=1\n", []Assignment{
+			{"K", "=", "a\nb", 1}, {"L", "=", "1", 3}}},
+		{"double quote across lines", "K=\"a\nb\"\nL=1\n", []Assignment{
+			{"K", "=", "a\nb", 1}, {"L", "=", "1", 3}}},
+
+		{"continuation within word", "K=a\\\nb\n", []Assignment{{"K", "=", "ab", 1}}},
+		{"continuation between words", "A=1 \\\nB=2\n", []Assignment{
+			{"A", "=", "1", 1}, {"B", "=", "2", 2}}},
+		{"continuation within double quotes", "K=\"a\\\nb\"\n", []Assignment{{"K", "=", "ab", 1}}},
+
+		{"expand from env", "K=$HOME/x\n", []Assignment{{"K", "=", "/home/u/x", 1}}},
+		{"expand braced", "K=${HOME}x\n", []Assignment{{"K", "=", "/home/ux", 1}}},
+		{"expand unset", "K=a${UNSET}b\n", []Assignment{{"K", "=", "ab", 1}}},
+		{"file before env", "A=from-file\nK=$A\n", []Assignment{
+			{"A", "=", "from-file", 1}, {"K", "=", "from-file", 2}}},
+		{"env until assigned", "K=$A\nA=from-file\n", []Assignment{
+			{"K", "=", "from-env", 1}, {"A", "=", "from-file", 2}}},
+		{"expand in double quotes", `B=x K="$B ${B}"`, []Assignment{
+			{"B", "=", "x", 1}, {"K", "=", "x x", 1}}},
+		{"expand ignores append", "B=x\nB+=y\nK=$B\n", []Assignment{
+			{"B", "=", "x", 1}, {"B", "+=", "y", 2}, {"K", "=", "x", 3}}},
+		{"expand typed by base name", "B:int=1\nK=$B\n", []Assignment{
+			{"B:int", "=", "1", 1}, {"K", "=", "1", 2}}},
+		{"literal dollar", "K=a$ L=$1x\n", []Assignment{{"K", "=", "a$", 1}, {"L", "=", "$1x", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse("test", []byte(tt.src), lookupTestEnv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		line, column int
+		reason       string
+	}{
+		{"command", "echo hi\n", 1, 1, "expected NAME=value assignment"},
+		{"command after assignment", "K=1\n  ls -l\n", 2, 3, "expected NAME=value assignment"},
+		{"bad name", "1K=V\n", 1, 1, "expected NAME=value assignment"},
+		{"pipe", "K=1 | x\n", 1, 5, "shell operator '|' not supported"},
+		{"redirect in word", "K=a>b\n", 1, 4, "shell operator '>' not supported"},
+		{"subshell", "(K=1)\n", 1, 1, "shell operator '(' not supported"},
+		{"backquote", "K=`date`\n", 1, 3, "command substitution not supported"},
+		{"backquote in double quotes", "K=\"`date`\"\n", 1, 4, "command substitution not supported"},
+		{"dollar paren", "K=$(date)\n", 1, 3, "command substitution not supported"},
+		{"default expansion", "K=${A:-x}\n", 1, 3, "parameter expansion other than ${NAME} not supported"},
+		{"unterminated single", "K=1\nL='abc\n", 2, 3, "unterminated single quote"},
+		{"unterminated double", "K=\"abc\n\n", 1, 3, "unterminated double quote"},
+		{"backslash at end", `K=a\`, 1, 4, "backslash at end of input"},
+		{"column in characters", "K=\"é\" é\n", 1, 7, "expected NAME=value assignment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test", []byte(tt.src), lookupTestEnv)
+			var syntaxErr *internal.KvSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got error %v, want KvSyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column || syntaxErr.Reason != tt.reason {
+				t.Errorf("got %d:%d: %s, want %d:%d: %s", syntaxErr.Line, syntaxErr.Column,
+					syntaxErr.Reason, tt.line, tt.column, tt.reason)
+			}
+		})
+	}
+}
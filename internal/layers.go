@@ -0,0 +1,139 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators of a KvpOp.
+const (
+	OpAssign = "="
+	OpAppend = "+="
+	OpRemove = "-="
+)
+
+// EnvPrefix introduces the names of environment variables supplying Keys,
+// e.g. GEMP_KV_UintSize=64,32.
+const EnvPrefix = "GEMP_KV_"
+
+type (
+	// KvpOp is one K=V1,V2...Vn, K+=V1... or K-=V1... found in some layer:
+	// a file of defaults, a '-kvpluspath' file, the environment, or the
+	// command line.
+	KvpOp struct {
+		KvpArg
+		Op     string // OpAssign, OpAppend or OpRemove
+		Source string // path of file, "environment", or "command line"
+		Line   int    // line of file, or 1-based index of arg; 0 if none
+	}
+
+	// ValueOrigin records the KvpOp that supplied one final Value.
+	ValueOrigin struct {
+		Value  string
+		Op     string
+		Source string
+		Line   int
+	}
+)
+
+// ResolveLayers applies 'ops' in turn, earliest layer first, each
+// overriding, appending to, or removing from the Values of earlier ops of
+// the same Key.  Keys are ordered by first appearance.  The Raw lists of
+// appending ops are joined by 'valueSep'.  Returns also the origin of each
+// final Value, indexed by Key.
+func ResolveLayers(ops []KvpOp, valueSep string) (kvpArgs []KvpArg, origins map[string][]ValueOrigin, err error) {
+	index := make(map[string]int) // Key -> index into 'kvpArgs'
+	origins = make(map[string][]ValueOrigin)
+	syntaxError := func(op KvpOp, reason string) error {
+		return &KvSyntaxError{
+			Source: op.Source,
+			Line:   op.Line,
+			Text:   op.Key + op.Op + op.Raw,
+			Reason: reason,
+		}
+	}
+
+	for _, op := range ops {
+		i, seen := index[op.Key]
+		if !seen {
+			if op.Op == OpRemove {
+				return nil, nil, syntaxError(op, "no earlier Values to remove from")
+			}
+			i = len(kvpArgs)
+			index[op.Key] = i
+			kvpArgs = append(kvpArgs, KvpArg{Key: op.Key})
+		}
+		kvp := &kvpArgs[i]
+		if op.Type != "" {
+			kvp.Type = op.Type
+		}
+
+		switch op.Op {
+		case OpAssign:
+			kvp.Values, kvp.Raw = nil, ""
+			origins[op.Key] = nil
+			fallthrough
+		case OpAppend:
+			switch {
+			case len(kvp.Values) == 0:
+				kvp.Raw = op.Raw
+			case kvp.Raw != "":
+				kvp.Raw += valueSep + op.Raw
+			}
+			for _, v := range op.Values {
+				kvp.Values = append(kvp.Values, v)
+				origins[op.Key] = append(origins[op.Key],
+					ValueOrigin{v, op.Op, op.Source, op.Line})
+			}
+		case OpRemove:
+			remove := make(map[string]bool, len(op.Values))
+			for _, v := range op.Values {
+				remove[v] = true
+			}
+			var values []string
+			var valueOrigins []ValueOrigin
+			for j, v := range kvp.Values {
+				if !remove[v] {
+					values = append(values, v)
+					valueOrigins = append(valueOrigins, origins[op.Key][j])
+				}
+			}
+			kvp.Values, origins[op.Key] = values, valueOrigins
+			kvp.Raw = ""
+			if len(values) == 0 {
+				return nil, nil, syntaxError(op, "no Values remain for Key")
+			}
+		}
+	}
+
+	// X  A later layer may declare a type contradicting Values of an
+	//    earlier one.
+	for _, kvp := range kvpArgs {
+		for j, v := range kvp.Values {
+			if _, err := ParseValue(kvp.Type, v); err != nil {
+				o := origins[kvp.Key][j]
+				return nil, nil, &KvSyntaxError{
+					Source: o.Source,
+					Line:   o.Line,
+					Text:   kvp.Key + o.Op + v,
+					Reason: fmt.Sprintf("value '%s' not of type %s", v, kvp.Type),
+				}
+			}
+		}
+	}
+	return kvpArgs, origins, nil
+}
+
+// SplitKeyOp splits the left-hand side of K=V, K+=V or K-=V, as found
+// before its '=', into Key and operator.
+func SplitKeyOp(lhs string) (key, op string) {
+	switch {
+	case strings.HasSuffix(lhs, "+"):
+		return lhs[:len(lhs)-1], OpAppend
+	case strings.HasSuffix(lhs, "-"):
+		return lhs[:len(lhs)-1], OpRemove
+	}
+	return lhs, OpAssign
+}
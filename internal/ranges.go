@@ -0,0 +1,109 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// maxRangeValues bounds the expansion of any one range, guarding against a
+// mistyped bound.
+const maxRangeValues = 1 << 16
+
+// rangeRE matches A..B, A..B:Step and A..B*Factor.
+var rangeRE = regexp.MustCompile(`^(-?[0-9]+)\.\.(-?[0-9]+)(?:([:*])([0-9]+))?$`)
+
+// ParseValueList splits 'list' as does SplitValues, then expands each
+// unquoted range among the Values into integers:
+//
+//	1..8       1,2,3,4,5,6,7,8
+//	0..64:8    0,8,16,...,64   (A..B:Step; descending if A > B)
+//	1..1024*2  1,2,4,...,1024  (A..B*Factor; 0 < A <= B)
+//
+// 'intRange' reports whether some range was expanded, and every other Value
+// is a decimal integer.
+func ParseValueList(list, sep string) (values []string, intRange bool, err error) {
+	elems, quoted, err := splitValues(list, sep)
+	if err != nil {
+		return nil, false, err
+	}
+	allInts, ranged := true, false
+	for i, elem := range elems {
+		m := rangeRE.FindStringSubmatch(elem)
+		if quoted[i] || m == nil {
+			if _, err := strconv.Atoi(elem); err != nil {
+				allInts = false
+			}
+			values = append(values, elem)
+			continue
+		}
+		expansion, err := expandRange(m[1], m[2], m[3], m[4])
+		if err != nil {
+			return nil, false, fmt.Errorf("range '%s': %v", elem, err)
+		}
+		values = append(values, expansion...)
+		ranged = true
+	}
+	return values, ranged && allInts, nil
+}
+
+func expandRange(from, to, op, operand string) ([]string, error) {
+	a, errA := strconv.Atoi(from)
+	b, errB := strconv.Atoi(to)
+	n := 1
+	var errN error
+	if operand != "" {
+		n, errN = strconv.Atoi(operand)
+	}
+	for _, err := range []error{errA, errB, errN} {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var values []string
+	appendValue := func(v int) error {
+		if len(values) >= maxRangeValues {
+			return fmt.Errorf("more than %d values", maxRangeValues)
+		}
+		values = append(values, strconv.Itoa(v))
+		return nil
+	}
+	switch {
+	case op == "*":
+		if n < 2 || a <= 0 || a > b {
+			return nil, fmt.Errorf("geometric range requires 0 < A <= B, and Factor >= 2")
+		}
+		for v := a; v <= b; v *= n {
+			if err := appendValue(v); err != nil {
+				return nil, err
+			}
+			if v > b/n { // X  next would exceed 'b', or overflow
+				break
+			}
+		}
+	case n <= 0:
+		return nil, fmt.Errorf("step must be positive")
+	case a <= b:
+		for v := a; v <= b; v += n {
+			if err := appendValue(v); err != nil {
+				return nil, err
+			}
+			if v > b-n { // X  next would exceed 'b', or overflow
+				break
+			}
+		}
+	default:
+		for v := a; v >= b; v -= n {
+			if err := appendValue(v); err != nil {
+				return nil, err
+			}
+			if v < b+n {
+				break
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package internal
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseValueList(t *testing.T) {
+	tests := []struct {
+		list     string
+		want     []string
+		intRange bool
+	}{
+		{"", nil, false},
+		{",,", nil, false},
+		{"1..4", []string{"1", "2", "3", "4"}, true},
+		{"3..3", []string{"3"}, true},
+		{"-2..1", []string{"-2", "-1", "0", "1"}, true},
+		{"0..10:4", []string{"0", "4", "8"}, true},
+		{"0..8:4", []string{"0", "4", "8"}, true},
+		{"4..1", []string{"4", "3", "2", "1"}, true},
+		{"10..0:4", []string{"10", "6", "2"}, true},
+		{"1..9*2", []string{"1", "2", "4", "8"}, true},
+		{"3..81*3", []string{"3", "9", "27", "81"}, true},
+		{"5..5*2", []string{"5"}, true},
+		{"0,1..2,7", []string{"0", "1", "2", "7"}, true},
+		{"x,1..2", []string{"x", "1", "2"}, false},
+		{`"1..2",3`, []string{"1..2", "3"}, false},
+		{"1,2", []string{"1", "2"}, false},
+		{"1...2,1..2:", []string{"1...2", "1..2:"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, intRange, err := ParseValueList(tt.list, ",")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || intRange != tt.intRange {
+				t.Errorf("got %v %v, want %v %v", got, intRange, tt.want, tt.intRange)
+			}
+		})
+	}
+}
+
+func TestParseValueListErrors(t *testing.T) {
+	tests := []struct {
+		list, reason string
+	}{
+		{"1..8:0", "range '1..8:0': step must be positive"},
+		{"8..1:0", "range '8..1:0': step must be positive"},
+		{"1..8*1", "range '1..8*1': geometric range requires 0 < A <= B, and Factor >= 2"},
+		{"1..8*0", "range '1..8*0': geometric range requires 0 < A <= B, and Factor >= 2"},
+		{"8..1*2", "range '8..1*2': geometric range requires 0 < A <= B, and Factor >= 2"},
+		{"0..8*2", "range '0..8*2': geometric range requires 0 < A <= B, and Factor >= 2"},
+		{"-4..8*2", "range '-4..8*2': geometric range requires 0 < A <= B, and Factor >= 2"},
+		{"0..70000", "range '0..70000': more than 65536 values"},
+		{"a,1..99999999999999999999", `range '1..99999999999999999999': strconv.Atoi: parsing "99999999999999999999": value out of range`},
+		{`"1..2`, "unterminated quote at offset 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			_, _, err := ParseValueList(tt.list, ",")
+			if err == nil || err.Error() != tt.reason {
+				t.Errorf("got error %v, want %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExpandRangeBounds(t *testing.T) {
+	// X  Neither ascending nor geometric ranges overflow near the limits of int.
+	max := strconv.Itoa(int(^uint(0) >> 1))
+	tests := []struct {
+		from, to, op, operand string
+		n                     int
+	}{
+		{max, max, "", "", 1},
+		{strings.TrimSuffix(max, "7") + "0", max, ":", "5", 2},
+		{"1", max, "*", "2", strconv.IntSize - 1},
+	}
+	for _, tt := range tests {
+		got, err := expandRange(tt.from, tt.to, tt.op, tt.operand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != tt.n {
+			t.Errorf("%s..%s%s%s: got %d values, want %d", tt.from, tt.to, tt.op, tt.operand, len(got), tt.n)
+		}
+	}
+}
@@ -2,9 +2,140 @@
 
 package internal
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueListSeparator separates the Values of a K=V1,V2...Vn pair, unless
+// overridden by '-valuesep'.
+const ValueListSeparator = ","
+
 type (
 	KvpArg struct {
 		Key    string
 		Values []string
+		// Declared by K:Type=V1,V2...Vn; one of ValueTypes, or "" if
+		// undeclared.
+		Type string
+		// V1,V2...Vn as given, neither split nor expanded, for 'dump'; ""
+		// if not known, as once Values have been removed.
+		Raw string
 	}
 )
+
+// ValueTypes are the types declarable for the Values of a Key.
+var ValueTypes = []string{"int", "uint", "float", "bool", "string"}
+
+// IsValueType reports whether 'valueType' is one of ValueTypes.
+func IsValueType(valueType string) bool {
+	for _, t := range ValueTypes {
+		if t == valueType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseValue converts 'value' to the Go type corresponding to 'valueType',
+// one of ValueTypes.  An empty 'valueType' yields 'int' if strconv.Atoi
+// accepts 'value', and otherwise 'string'.  Integers are in Go literal
+// syntax, e.g. 0x10.
+func ParseValue(valueType, value string) (interface{}, error) {
+	switch valueType {
+	case "":
+		if intV, err := strconv.Atoi(value); err == nil {
+			return intV, nil
+		}
+		return value, nil
+	case "int":
+		v, err := strconv.ParseInt(value, 0, 0)
+		return int(v), err
+	case "uint":
+		v, err := strconv.ParseUint(value, 0, 0)
+		return uint(v), err
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "string":
+		return value, nil
+	}
+	return nil, fmt.Errorf("unknown type '%s', not one of %s",
+		valueType, strings.Join(ValueTypes, ", "))
+}
+
+// SplitValues splits 'list' into Values at each 'sep'.  A Value enclosed in
+// double quotes may contain 'sep', with \" and \\ escaping a quote and a
+// backslash.  Outside of quotes, a backslash escapes a following 'sep',
+// quote or backslash.  Empty unquoted Values are dropped; "" yields an
+// empty Value.
+func SplitValues(list, sep string) ([]string, error) {
+	values, _, err := splitValues(list, sep)
+	return values, err
+}
+
+// splitValues is SplitValues, reporting also which Values were quoted.
+func splitValues(list, sep string) (values []string, quotedValues []bool, err error) {
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(list); {
+		switch {
+		case strings.HasPrefix(list[i:], sep):
+			if value.Len() > 0 || quoted {
+				values = append(values, value.String())
+				quotedValues = append(quotedValues, quoted)
+			}
+			value.Reset()
+			quoted = false
+			i += len(sep)
+		case list[i] == '"' && value.Len() == 0 && !quoted:
+			end := i + 1
+			for ; end < len(list) && list[end] != '"'; end++ {
+				if list[end] == '\\' && end+1 < len(list) && strings.IndexByte(`"\`, list[end+1]) >= 0 {
+					end++
+				}
+				value.WriteByte(list[end])
+			}
+			if end >= len(list) {
+				return nil, nil, fmt.Errorf("unterminated quote at offset %d", i)
+			}
+			i = end + 1
+			if i < len(list) && !strings.HasPrefix(list[i:], sep) {
+				return nil, nil, fmt.Errorf("text follows closing quote at offset %d", i)
+			}
+			quoted = true
+		case list[i] == '\\' && strings.HasPrefix(list[i+1:], sep):
+			value.WriteString(sep)
+			i += 1 + len(sep)
+		case list[i] == '\\' && i+1 < len(list) && strings.IndexByte(`"\`, list[i+1]) >= 0:
+			value.WriteByte(list[i+1])
+			i += 2
+		default:
+			value.WriteByte(list[i])
+			i++
+		}
+	}
+	if value.Len() > 0 || quoted {
+		values = append(values, value.String())
+		quotedValues = append(quotedValues, quoted)
+	}
+	return values, quotedValues, nil
+}
+
+// JoinValues is the inverse of ParseValueList, quoting only those Values
+// that require it, including any that would otherwise expand as a range.
+func JoinValues(values []string, sep string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		if v != "" && !strings.Contains(v, sep) && !strings.ContainsAny(v, `"\`) &&
+			!rangeRE.MatchString(v) {
+			quoted[i] = v
+			continue
+		}
+		v = strings.ReplaceAll(v, `\`, `\\`)
+		quoted[i] = `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+	}
+	return strings.Join(quoted, sep)
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Donald Mullis. All rights reserved.
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		valueType, value string
+		want             interface{}
+	}{
+		{"", "8", 8},
+		{"", "-8", -8},
+		{"", "0x10", "0x10"}, // guessed only in decimal
+		{"", "1.5", "1.5"},
+		{"", "true", "true"},
+		{"", "", ""},
+		{"int", "0x10", 16},
+		{"int", "-010", -8},
+		{"int", "0b11", 3},
+		{"uint", "255", uint(255)},
+		{"uint", "0xff", uint(255)},
+		{"float", "1.5", 1.5},
+		{"float", "2", 2.0},
+		{"float", "1e3", 1000.0},
+		{"bool", "true", true},
+		{"bool", "0", false},
+		{"string", "8", "8"},
+		{"string", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.valueType+"="+tt.value, func(t *testing.T) {
+			got, err := ParseValue(tt.valueType, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValueErrors(t *testing.T) {
+	tests := []struct {
+		valueType, value string
+	}{
+		{"int", "x"},
+		{"int", "1.5"},
+		{"int", ""},
+		{"uint", "-1"},
+		{"float", "one"},
+		{"bool", "yes"},
+		{"complex", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.valueType+"="+tt.value, func(t *testing.T) {
+			if v, err := ParseValue(tt.valueType, tt.value); err == nil {
+				t.Errorf("got %#v, want error", v)
+			}
+		})
+	}
+}
+
+func TestSplitValues(t *testing.T) {
+	tests := []struct {
+		list, sep string
+		want      []string
+		quoted    []bool
+	}{
+		{"", ",", nil, nil},
+		{"a,b,c", ",", []string{"a", "b", "c"}, []bool{false, false, false}},
+		{"a,,b,", ",", []string{"a", "b"}, []bool{false, false}},
+		{`"",a`, ",", []string{"", "a"}, []bool{true, false}},
+		{`"a,b",c`, ",", []string{"a,b", "c"}, []bool{true, false}},
+		{`"say \"hi\"","a\\b"`, ",", []string{`say "hi"`, `a\b`}, []bool{true, true}},
+		{`"a\x"`, ",", []string{`a\x`}, []bool{true}},
+		{`a\,b,c`, ",", []string{"a,b", "c"}, []bool{false, false}},
+		{`a\"b\\`, ",", []string{`a"b\`}, []bool{false}},
+		{`a\b`, ",", []string{`a\b`}, []bool{false}},
+		{`a"b`, ",", []string{`a"b`}, []bool{false}},
+		{"a;b,c", ";", []string{"a", "b,c"}, []bool{false, false}},
+		{`a\;b;"c;d"`, ";", []string{"a;b", "c;d"}, []bool{false, true}},
+		{"a::b", "::", []string{"a", "b"}, []bool{false, false}},
+		{`"1..3",1..3`, ",", []string{"1..3", "1..3"}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sep+" "+tt.list, func(t *testing.T) {
+			got, quoted, err := splitValues(tt.list, tt.sep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(quoted, tt.quoted) {
+				t.Errorf("got %q %v, want %q %v", got, quoted, tt.want, tt.quoted)
+			}
+		})
+	}
+}
+
+func TestSplitValuesErrors(t *testing.T) {
+	tests := []struct {
+		list, reason string
+	}{
+		{`"abc`, "unterminated quote at offset 0"},
+		{`a,"b\"`, "unterminated quote at offset 2"},
+		{`"a"b,c`, "text follows closing quote at offset 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			_, err := SplitValues(tt.list, ",")
+			if err == nil || err.Error() != tt.reason {
+				t.Errorf("got error %v, want %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestJoinValues(t *testing.T) {
+	tests := []struct {
+		values []string
+		sep    string
+		want   string
+	}{
+		{nil, ",", ""},
+		{[]string{"a", "b"}, ",", "a,b"},
+		{[]string{""}, ",", `""`},
+		{[]string{"a,b", "c"}, ",", `"a,b",c`},
+		{[]string{"a,b"}, ";", "a,b"},
+		{[]string{`say "hi"`, `a\b`}, ",", `"say \"hi\"","a\\b"`},
+		{[]string{"1..3", "1..8:2", "1..8*2", "1.5"}, ",", `"1..3","1..8:2","1..8*2",1.5`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := JoinValues(tt.values, tt.sep)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			// X  JoinValues inverts ParseValueList, ranges included.
+			back, _, err := ParseValueList(got, tt.sep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(back) != len(tt.values) || (len(back) > 0 && !reflect.DeepEqual(back, tt.values)) {
+				t.Errorf("got back %q, want %q", back, tt.values)
+			}
+		})
+	}
+}
@@ -33,13 +33,14 @@ echo '    dlv debug '$PWD' -- GEMP_ARGS ...'
 #       https://docs.github.com/en/github/writing-on-github/basic-writing-and-formatting-syntax#relative-links
 gemp -helpAsMarkdown -h     2>doc/usage.md
 gemp -helpAsMarkdown -h gen 2>doc/gen-usage.md
+gemp -helpAsMarkdown -h dump 2>doc/dump-usage.md
 
 # Alternative Markdown processors:
 #    1.  'blackfriday'
 #    2.  https://pkg.go.dev/github.com/shurcooL/github_flavored_markdown
 #        https://github.com/shurcooL/github_flavored_markdown/issues
 #    3.  https://docs.github.com/en/rest/reference/markdown
-for mdFile in README.md doc/usage.md doc/gen-usage.md
+for mdFile in README.md doc/usage.md doc/gen-usage.md doc/dump-usage.md
 do
     #  --gfm => "GitHub-Flavored-Markdown"
     #    XXX  Despite --gfm, does NOT transform link references to ".md" files into ".html", as